@@ -0,0 +1,156 @@
+package candle
+
+import (
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+	"iter"
+	"time"
+)
+
+// Side selects which tick price a candle is built from.
+type Side string
+
+const (
+	SideBid Side = "bid"
+	SideAsk Side = "ask"
+	SideMid Side = "mid"
+)
+
+type Candle struct {
+	Symbol    string  `validate:"required" json:"symbol" csv:"symbol"`
+	Timestamp int64   `validate:"required" json:"timestamp" csv:"timestamp"`
+	Open      float64 `validate:"required" json:"open" csv:"open"`
+	High      float64 `validate:"required" json:"high" csv:"high"`
+	Low       float64 `validate:"required" json:"low" csv:"low"`
+	Close     float64 `validate:"required" json:"close" csv:"close"`
+	Volume    float64 `json:"volume" csv:"volume"`
+	Ticks     int     `json:"ticks" csv:"ticks"`
+}
+
+func New() *Candle {
+	return &Candle{}
+}
+
+func (c *Candle) WithSymbol(symbol string) *Candle {
+	c.Symbol = symbol
+	return c
+}
+
+func (c *Candle) WithTimestamp(timestamp int64) *Candle {
+	c.Timestamp = timestamp
+	return c
+}
+
+// Aggregate groups the ticks of seq into candles of the given period with UTC boundaries.
+// Ticks are expected in ascending timestamp order; a candle is yielded once a tick of a later period arrives
+// or seq ends. Errors from seq are passed through.
+func Aggregate(seq iter.Seq2[*tick.Tick, error], period time.Duration, side Side) iter.Seq2[*Candle, error] {
+	return AggregateIn(seq, period, side, time.UTC)
+}
+
+// AggregateIn groups ticks like Aggregate with candle boundaries following the wall clock of loc.
+// Periods of whole days span local calendar days and shorter periods are aligned to local midnight,
+// so candles stay aligned across DST changes; on those days the affected candles are shorter or longer.
+func AggregateIn(seq iter.Seq2[*tick.Tick, error], period time.Duration, side Side, loc *time.Location) iter.Seq2[*Candle, error] {
+	return func(yield func(*Candle, error) bool) {
+		if period <= 0 {
+			yield(nil, fmt.Errorf("candle period must be positive, got %s", period))
+			return
+		}
+
+		var current *Candle
+		for t, err := range seq {
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+
+			price, volume, err := sidePrice(t, side)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			start := PeriodStart(t.Timestamp, period, loc)
+			if current != nil && current.Timestamp != start {
+				if !yield(current, nil) {
+					return
+				}
+				current = nil
+			}
+
+			if current == nil {
+				current = &Candle{
+					Symbol:    t.Symbol,
+					Timestamp: start,
+					Open:      price,
+					High:      price,
+					Low:       price,
+				}
+			}
+
+			current.High = max(current.High, price)
+			current.Low = min(current.Low, price)
+			current.Close = price
+			current.Volume += volume
+			current.Ticks++
+		}
+
+		if current != nil {
+			yield(current, nil)
+		}
+	}
+}
+
+func sidePrice(t *tick.Tick, side Side) (float64, float64, error) {
+	switch side {
+	case SideBid:
+		return t.Bid, t.VolumeBid, nil
+	case SideAsk:
+		return t.Ask, t.VolumeAsk, nil
+	case SideMid:
+		return (t.Ask + t.Bid) / 2, t.VolumeAsk + t.VolumeBid, nil
+	default:
+		return 0, 0, fmt.Errorf("unknown candle side %q", side)
+	}
+}
+
+// PeriodStart returns the start, in Unix nanoseconds, of the candle of the given period containing
+// the timestamp, with boundaries following the wall clock of loc.
+func PeriodStart(nanos int64, period time.Duration, loc *time.Location) int64 {
+	if loc == nil || loc == time.UTC {
+		return nanos - nanos%int64(period)
+	}
+
+	t := time.Unix(0, nanos).In(loc)
+	year, month, day := t.Date()
+
+	const dayLength = 24 * time.Hour
+	if period%dayLength == 0 {
+		days := int64(period / dayLength)
+		dayIndex := time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / int64(dayLength/time.Second)
+		dayIndex -= ((dayIndex % days) + days) % days
+		start := time.Unix(dayIndex*int64(dayLength/time.Second), 0).UTC()
+
+		return timestamp.ResolveWallTime(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc).UnixNano()
+	}
+
+	wall := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second + time.Duration(t.Nanosecond())
+	wall -= wall % period
+	hour, minute, second := int(wall/time.Hour), int(wall%time.Hour/time.Minute), int(wall%time.Minute/time.Second)
+	nsec := int(wall % time.Second)
+
+	// Inside a DST overlap the same wall time occurs twice; the candle starts at the latest occurrence not after the tick.
+	candidates := timestamp.WallTimeCandidates(year, month, day, hour, minute, second, nsec, loc)
+	for i := len(candidates) - 1; i >= 0; i-- {
+		if candidates[i].UnixNano() <= nanos {
+			return candidates[i].UnixNano()
+		}
+	}
+
+	return timestamp.ResolveWallTime(year, month, day, hour, minute, second, nsec, loc).UnixNano()
+}
@@ -0,0 +1,54 @@
+package candle
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func utc(value string) time.Time {
+	t, err := time.Parse(time.DateTime, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+func TestPeriodStart(t *testing.T) {
+	tests := []struct {
+		name     string
+		location string
+		period   time.Duration
+		tick     string
+		want     string
+	}{
+		{"utc hour", "UTC", time.Hour, "2024-03-10 07:15:00", "2024-03-10 07:00:00"},
+		{"new york hour after spring gap", "America/New_York", time.Hour, "2024-03-10 07:15:00", "2024-03-10 07:00:00"},
+		{"new york two hours across spring gap", "America/New_York", 2 * time.Hour, "2024-03-10 07:30:00", "2024-03-10 07:00:00"},
+		{"new york day of spring gap", "America/New_York", 24 * time.Hour, "2024-03-10 12:00:00", "2024-03-10 05:00:00"},
+		{"new york hour in first fall overlap", "America/New_York", time.Hour, "2024-11-03 05:15:00", "2024-11-03 05:00:00"},
+		{"new york hour in second fall overlap", "America/New_York", time.Hour, "2024-11-03 06:15:00", "2024-11-03 06:00:00"},
+		{"new york quarter in second fall overlap", "America/New_York", 15 * time.Minute, "2024-11-03 06:20:00", "2024-11-03 06:15:00"},
+		{"new york day of fall overlap", "America/New_York", 24 * time.Hour, "2024-11-03 12:00:00", "2024-11-03 04:00:00"},
+		{"london hour after spring gap", "Europe/London", time.Hour, "2024-03-31 01:15:00", "2024-03-31 01:00:00"},
+		{"london day of spring gap", "Europe/London", 24 * time.Hour, "2024-03-31 12:00:00", "2024-03-31 00:00:00"},
+		{"london hour in first fall overlap", "Europe/London", time.Hour, "2024-10-27 00:15:00", "2024-10-27 00:00:00"},
+		{"london hour in second fall overlap", "Europe/London", time.Hour, "2024-10-27 01:15:00", "2024-10-27 01:00:00"},
+		{"london day of fall overlap", "Europe/London", 24 * time.Hour, "2024-10-27 12:00:00", "2024-10-26 23:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loc, err := time.LoadLocation(tt.location)
+			if err != nil {
+				t.Fatalf("LoadLocation(%s): %v", tt.location, err)
+			}
+
+			got := PeriodStart(utc(tt.tick).UnixNano(), tt.period, loc)
+			if want := utc(tt.want); got != want.UnixNano() {
+				t.Fatalf("got %s, want %s", time.Unix(0, got).UTC(), want)
+			}
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+)
+
+// Mode selects how a Recorder uses its cassette.
+type Mode string
+
+const (
+	// ModeRecord sends every request to the network and records the exchange, replacing earlier recordings.
+	ModeRecord Mode = "record"
+	// ModeReplay answers every request from the cassette and never touches the network.
+	ModeReplay Mode = "replay"
+	// ModeRecordMissing answers from the cassette when possible and records the requests it could not answer.
+	ModeRecordMissing Mode = "record-missing"
+)
+
+// ErrInteractionNotFound is returned in replay mode for requests the cassette holds no exchange for.
+// It is permanent: retryablehttp.DefaultClassifier does not retry it, since replaying again cannot succeed.
+var ErrInteractionNotFound error = permanentError("no recorded interaction for request")
+
+// permanentError is an error that repeating the request cannot fix.
+type permanentError string
+
+func (e permanentError) Error() string {
+	return string(e)
+}
+
+// Permanent implements retryablehttp.PermanentError.
+func (e permanentError) Permanent() bool {
+	return true
+}
+
+// Interaction is a single recorded HTTP exchange. Body holds the response body exactly as it was
+// received on the wire, before any content decoding.
+type Interaction struct {
+	Method     string      `json:"method"`
+	Url        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+}
+
+// Cassette is an ordered set of interactions keyed by request method and URL.
+type Cassette struct {
+	Interactions []*Interaction `json:"interactions"`
+
+	mu    sync.RWMutex
+	index map[string]int
+}
+
+func New() *Cassette {
+	return &Cassette{
+		index: make(map[string]int),
+	}
+}
+
+// Load reads a cassette from filePath.
+func Load(filePath string) (*Cassette, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", filePath, err)
+	}
+
+	c := New()
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to decode cassette %s: %w", filePath, err)
+	}
+
+	for i, interaction := range c.Interactions {
+		c.index[key(interaction.Method, interaction.Url)] = i
+	}
+
+	return c, nil
+}
+
+// Save writes the cassette to filePath.
+func (c *Cassette) Save(filePath string) error {
+	c.mu.RLock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	c.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode cassette: %w", err)
+	}
+
+	if err := os.WriteFile(filePath, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write cassette %s: %w", filePath, err)
+	}
+
+	return nil
+}
+
+// Find returns the interaction recorded for method and url, if any.
+func (c *Cassette) Find(method, url string) (*Interaction, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	i, ok := c.index[key(method, url)]
+	if !ok {
+		return nil, false
+	}
+
+	return c.Interactions[i], true
+}
+
+// Add records interaction, replacing any earlier interaction for the same method and URL.
+func (c *Cassette) Add(interaction *Interaction) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := key(interaction.Method, interaction.Url)
+	if i, ok := c.index[k]; ok {
+		c.Interactions[i] = interaction
+		return
+	}
+
+	c.index[k] = len(c.Interactions)
+	c.Interactions = append(c.Interactions, interaction)
+}
+
+// Has reports whether the cassette holds a GET exchange for url, which lets a cassette act as a download cache.
+func (c *Cassette) Has(url string) bool {
+	_, ok := c.Find(http.MethodGet, url)
+	return ok
+}
+
+func key(method, url string) string {
+	return method + " " + url
+}
+
+// Recorder is an http.RoundTripper recording exchanges into, or replaying them from, a cassette.
+type Recorder struct {
+	cassette *Cassette
+	mode     Mode
+	next     http.RoundTripper
+}
+
+// NewRecorder returns a Recorder using cassette in the given mode. next performs the real round trips
+// in record modes; nil uses http.DefaultTransport.
+func NewRecorder(cassette *Cassette, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	switch mode {
+	case ModeRecord, ModeReplay, ModeRecordMissing:
+	default:
+		return nil, fmt.Errorf("unknown cassette mode %q", mode)
+	}
+
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	return &Recorder{
+		cassette: cassette,
+		mode:     mode,
+		next:     next,
+	}, nil
+}
+
+// Open loads the cassette at filePath, or starts an empty one when recording and the file does not
+// exist yet, and returns a Recorder for it. Call Save on the cassette once the run is over to persist it.
+func Open(filePath string, mode Mode, next http.RoundTripper) (*Recorder, error) {
+	c, err := Load(filePath)
+	if err != nil {
+		if mode == ModeReplay || !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		c = New()
+	}
+
+	return NewRecorder(c, mode, next)
+}
+
+// Cassette returns the cassette used by the recorder.
+func (r *Recorder) Cassette() *Cassette {
+	return r.cassette
+}
+
+// Client returns an http.Client using the recorder as its transport, ready for Downloader.WithHttpClient.
+func (r *Recorder) Client() *http.Client {
+	return &http.Client{Transport: r}
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode != ModeRecord {
+		if interaction, ok := r.cassette.Find(req.Method, req.URL.String()); ok {
+			return interaction.response(req), nil
+		}
+
+		if r.mode == ModeReplay {
+			return nil, fmt.Errorf("%w: %s %s", ErrInteractionNotFound, req.Method, req.URL)
+		}
+	}
+
+	resp, err := r.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body for recording: %w", err)
+	}
+
+	interaction := &Interaction{
+		Method:     req.Method,
+		Url:        req.URL.String(),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header.Clone(),
+		Body:       body,
+	}
+	r.cassette.Add(interaction)
+
+	return interaction.response(req), nil
+}
+
+func (i *Interaction) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", i.StatusCode, http.StatusText(i.StatusCode)),
+		StatusCode:    i.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        i.Header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(i.Body)),
+		ContentLength: int64(len(i.Body)),
+		Request:       req,
+	}
+}
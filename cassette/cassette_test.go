@@ -0,0 +1,176 @@
+package cassette
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/condrove10/dukascopy-downloader/retryablehttp"
+)
+
+// countingTransport answers every request with a body naming its path and counts the requests.
+type countingTransport struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.mu.Lock()
+	c.calls++
+	c.mu.Unlock()
+
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"X-Path": []string{r.URL.Path}},
+		Body:       io.NopCloser(strings.NewReader("body of " + r.URL.Path)),
+		Request:    r,
+	}, nil
+}
+
+func get(t *testing.T, client *http.Client, url string) (string, error) {
+	t.Helper()
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read %s: %v", url, err)
+	}
+
+	return string(body), nil
+}
+
+// record records the given paths into a cassette saved at path.
+func record(t *testing.T, path string, urls ...string) {
+	t.Helper()
+
+	rec, err := Open(path, ModeRecord, &countingTransport{})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	for _, url := range urls {
+		if _, err := get(t, rec.Client(), url); err != nil {
+			t.Fatalf("record %s: %v", url, err)
+		}
+	}
+	if err := rec.Cassette().Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	record(t, path, "http://example.test/a", "http://example.test/b")
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if len(loaded.Interactions) != 2 || !loaded.Has("http://example.test/a") || !loaded.Has("http://example.test/b") {
+		t.Fatalf("got %d interactions, want a and b", len(loaded.Interactions))
+	}
+
+	network := &countingTransport{}
+	rec, err := NewRecorder(loaded, ModeReplay, network)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	body, err := get(t, rec.Client(), "http://example.test/b")
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if body != "body of /b" {
+		t.Fatalf("got body %q", body)
+	}
+	if network.calls != 0 {
+		t.Fatalf("replay made %d network requests", network.calls)
+	}
+}
+
+func TestReplayMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	record(t, path, "http://example.test/a")
+
+	network := &countingTransport{}
+	rec, err := Open(path, ModeReplay, network)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	_, err = get(t, rec.Client(), "http://example.test/missing")
+	if !errors.Is(err, ErrInteractionNotFound) {
+		t.Fatalf("got %v, want ErrInteractionNotFound", err)
+	}
+	if network.calls != 0 {
+		t.Fatalf("replay made %d network requests", network.calls)
+	}
+
+	if outcome := retryablehttp.DefaultClassifier(nil, err); outcome != retryablehttp.OutcomePermanent {
+		t.Fatalf("a missing interaction is classified %s, want permanent", outcome)
+	}
+}
+
+func TestReplayMissingIsNotRetried(t *testing.T) {
+	rec, err := NewRecorder(New(), ModeReplay, nil)
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	var retries int
+	start := time.Now()
+	_, err = retryablehttp.DefaultClient.WithHttpClient(rec.Client()).WithMethod(retryablehttp.MethodGet).
+		WithUrl("http://example.test/missing").WithMaxRetries(5).WithRetryDelay(time.Minute).
+		WithClassifier(retryablehttp.DefaultClassifier).
+		WithOnRetry(func(int, time.Duration, error) { retries++ }).
+		DoAndRead()
+
+	if !errors.Is(err, ErrInteractionNotFound) {
+		t.Fatalf("got %v, want ErrInteractionNotFound", err)
+	}
+	if retries != 0 || time.Since(start) > 5*time.Second {
+		t.Fatalf("a missing interaction was retried %d times", retries)
+	}
+}
+
+func TestRecordMissing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	record(t, path, "http://example.test/a")
+
+	network := &countingTransport{}
+	rec, err := Open(path, ModeRecordMissing, network)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+
+	for _, url := range []string{"http://example.test/a", "http://example.test/b", "http://example.test/b"} {
+		if _, err := get(t, rec.Client(), url); err != nil {
+			t.Fatalf("get %s: %v", url, err)
+		}
+	}
+
+	if network.calls != 1 {
+		t.Fatalf("made %d network requests, want 1 for the missing interaction", network.calls)
+	}
+	if !rec.Cassette().Has("http://example.test/b") {
+		t.Fatal("the missing interaction was not recorded")
+	}
+}
+
+func TestOpenReplayRequiresCassette(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.json"), ModeReplay, nil); err == nil {
+		t.Fatal("Open replayed a cassette that does not exist")
+	}
+	if _, err := NewRecorder(New(), Mode("rewind"), nil); err == nil {
+		t.Fatal("NewRecorder accepted an unknown mode")
+	}
+}
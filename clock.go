@@ -0,0 +1,25 @@
+package downloader
+
+import (
+	"time"
+)
+
+// Clock tells the downloader the current time, which decides the most recent hour it may request.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is the Clock backed by time.Now.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (d *Downloader) now() time.Time {
+	if d.Clock == nil {
+		return time.Now()
+	}
+
+	return d.Clock.Now()
+}
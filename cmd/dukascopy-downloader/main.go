@@ -0,0 +1,267 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	downloader "github.com/condrove10/dukascopy-downloader"
+	"github.com/condrove10/dukascopy-downloader/cassette"
+	"github.com/condrove10/dukascopy-downloader/compression"
+	"github.com/condrove10/dukascopy-downloader/csvencoder"
+	"github.com/condrove10/dukascopy-downloader/sink"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+)
+
+type options struct {
+	symbols      string
+	start        string
+	end          string
+	concurrency  int
+	output       string
+	plan         bool
+	listUrls     bool
+	cassettePath string
+	cassetteMode string
+	statsPath    string
+	timezone     string
+	timeFormat   string
+	locale       string
+	rotate       string
+	maxTicks     int64
+	maxBytes     int64
+	append       bool
+	compression  string
+	level        int
+}
+
+func main() {
+	opts := options{}
+	flag.StringVar(&opts.symbols, "symbols", "", "comma separated list of symbols, e.g. EURUSD,GBPUSD")
+	flag.StringVar(&opts.start, "start", "", "start time, RFC3339, YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	flag.StringVar(&opts.end, "end", "", "end time (excluded), RFC3339, YYYY-MM-DD or YYYY-MM-DD HH:MM:SS")
+	flag.IntVar(&opts.concurrency, "concurrency", 4, "number of concurrent hour requests")
+	flag.StringVar(&opts.output, "output", "{symbol}.csv", "output file template with {symbol}, {yyyy}, {mm}, {dd}, {hh} and {seq} placeholders; a .jsonl extension writes JSON lines")
+	flag.BoolVar(&opts.plan, "plan", false, "print the download plan instead of downloading")
+	flag.BoolVar(&opts.listUrls, "urls", false, "list every hour URL and its cache status in plan mode")
+	flag.StringVar(&opts.cassettePath, "cassette", "", "cassette file used as cache in plan mode and as transport otherwise")
+	flag.StringVar(&opts.cassetteMode, "cassette-mode", string(cassette.ModeRecordMissing), "cassette mode: record, replay or record-missing")
+	flag.StringVar(&opts.statsPath, "stats", "", "file the transfer statistics of every symbol are saved to after its download and -plan estimates are read from, e.g. dukascopy-stats.json")
+	flag.StringVar(&opts.timezone, "timezone", "", "IANA timezone for -start, -end and exported timestamps, e.g. Europe/London")
+	flag.StringVar(&opts.timeFormat, "timestamp-format", "", "exported timestamp format: unix_s, unix_ms, unix_us, unix_ns, rfc3339[:digits], split[:digits] or layout:<go layout>; defaults to unix_ns, or rfc3339 with -timezone")
+	flag.StringVar(&opts.locale, "locale", "", "language whose decimal separator CSV prices use, e.g. de for a decimal comma")
+	flag.StringVar(&opts.rotate, "rotate", "", "start a new output file every hour, day, month or year; defaults to the finest date placeholder of -output")
+	flag.Int64Var(&opts.maxTicks, "max-ticks", 0, "start a new output file after this many ticks")
+	flag.Int64Var(&opts.maxBytes, "max-bytes", 0, "start a new output file after about this many bytes")
+	flag.BoolVar(&opts.append, "append", false, "extend existing output files, skipping ticks they already hold")
+	flag.StringVar(&opts.compression, "compression", "auto", "output compression: auto (from a .gz or .zst extension), none, gzip or zstd")
+	flag.IntVar(&opts.level, "compression-level", 0, "compression level, gzip 1-9 or zstd 1-22; 0 is the default")
+	flag.Parse()
+
+	if err := run(opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) (err error) {
+	var location *time.Location
+	if opts.timezone != "" {
+		loc, err := time.LoadLocation(opts.timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %w", err)
+		}
+		location = loc
+	}
+
+	format := timestamp.DefaultFormat(location)
+	if opts.timeFormat != "" {
+		parsed, err := timestamp.ParseFormat(opts.timeFormat)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp format: %w", err)
+		}
+		format = parsed.WithLocation(location)
+	}
+
+	locale, err := csvencoder.ParseLocale(opts.locale)
+	if err != nil {
+		return err
+	}
+
+	period, err := sink.ParsePeriod(opts.rotate)
+	if err != nil {
+		return err
+	}
+	rotate := sink.RotateOptions{Period: period, MaxTicks: opts.maxTicks, MaxBytes: opts.maxBytes, Location: location}
+
+	codec, err := compression.ParseCodec(opts.compression)
+	if err != nil {
+		return err
+	}
+	file := sink.FileOptions{Compression: codec, CompressionLevel: opts.level, Append: opts.append}
+
+	start, err := parseTime(opts.start, location)
+	if err != nil {
+		return fmt.Errorf("invalid start time: %w", err)
+	}
+
+	end, err := parseTime(opts.end, location)
+	if err != nil {
+		return fmt.Errorf("invalid end time: %w", err)
+	}
+
+	if opts.symbols == "" {
+		return fmt.Errorf("no symbols given")
+	}
+
+	var recorder *cassette.Recorder
+	if opts.cassettePath != "" {
+		recorder, err = cassette.Open(opts.cassettePath, cassette.Mode(opts.cassetteMode), http.DefaultTransport)
+		if err != nil {
+			return fmt.Errorf("failed to open cassette: %w", err)
+		}
+
+		// Save what was recorded even when a symbol fails, so the next run does not fetch it again.
+		if !opts.plan {
+			defer func() {
+				if serr := recorder.Cassette().Save(opts.cassettePath); err == nil {
+					err = serr
+				}
+			}()
+		}
+	}
+
+	history := downloader.StatsFile{}
+	if opts.statsPath != "" {
+		history, err = downloader.LoadStatsFile(opts.statsPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, symbol := range strings.Split(opts.symbols, ",") {
+		d := &downloader.Downloader{
+			Symbol:            strings.TrimSpace(symbol),
+			StartTime:         start,
+			EndTime:           end,
+			Concurrency:       opts.concurrency,
+			DecodeConcurrency: downloader.DefaultDownloader.DecodeConcurrency,
+			HttpClient:        http.DefaultClient,
+			AttemptTimeout:    downloader.DefaultDownloader.AttemptTimeout,
+			Location:          location,
+		}
+
+		if opts.plan {
+			planOptions := downloader.PlanOptions{Estimates: history.Estimates()}
+			if recorder != nil {
+				planOptions.Cache = recorder.Cassette()
+			}
+
+			plan, err := d.Plan(planOptions)
+			if err != nil {
+				return fmt.Errorf("failed to plan %s: %w", d.Symbol, err)
+			}
+
+			if err := plan.Write(os.Stdout, opts.listUrls); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if recorder != nil {
+			d.HttpClient = recorder.Client()
+		}
+
+		output := strings.ReplaceAll(opts.output, "{symbol}", d.Symbol)
+		stats, err := export(d, output, exportOptions{timestamp: format, locale: locale, rotate: rotate, file: file})
+		if err != nil {
+			return fmt.Errorf("failed to download %s: %w", d.Symbol, err)
+		}
+
+		fmt.Fprintf(os.Stderr, "%s: %s\n", d.Symbol, stats)
+
+		// Keep the previous statistics when nothing was fetched, as they estimate better than none.
+		if opts.statsPath != "" && stats.Hours > 0 {
+			history[d.Symbol] = stats
+			if err := history.Save(opts.statsPath); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportOptions holds the output settings shared by every symbol.
+type exportOptions struct {
+	timestamp timestamp.Format
+	locale    csvencoder.Locale
+	rotate    sink.RotateOptions
+	file      sink.FileOptions
+}
+
+// export streams the ticks of d into output, as JSON lines if it has a .jsonl extension and as CSV otherwise.
+// Outputs with placeholders or a rotation limit are split into several files; without -rotate, date
+// placeholders rotate on the finest of them, e.g. one file per day for {dd}.
+func export(d *downloader.Downloader, output string, options exportOptions) (downloader.Stats, error) {
+	jsonl := strings.Contains(filepath.Base(output), ".jsonl")
+	csvOptions := sink.CSVOptions{Separator: ';', Timestamp: options.timestamp, Locale: options.locale, FileOptions: options.file}
+	jsonlOptions := sink.JSONLOptions{Timestamp: options.timestamp, FileOptions: options.file}
+
+	var s sink.Sink
+	var err error
+	switch {
+	case options.rotate.Period != sink.PeriodNone || options.rotate.MaxTicks > 0 || options.rotate.MaxBytes > 0 || strings.Contains(output, "{"):
+		s = sink.NewRotating(output, options.rotate, func(path string) (sink.Sink, error) {
+			if jsonl {
+				return sink.CreateJSONL(path, jsonlOptions)
+			}
+			return sink.CreateCSV(path, csvOptions)
+		})
+	case jsonl:
+		s, err = sink.CreateJSONL(output, jsonlOptions)
+	default:
+		s, err = sink.CreateCSV(output, csvOptions)
+	}
+	if err != nil {
+		return downloader.Stats{}, err
+	}
+
+	stats, err := d.ToSink(s)
+	if err != nil {
+		sink.Abort(s)
+		return downloader.Stats{}, err
+	}
+
+	if err := s.Close(); err != nil {
+		return downloader.Stats{}, fmt.Errorf("failed to write file %s: %w", output, err)
+	}
+
+	return stats, nil
+}
+
+// parseTime parses an RFC3339 time, or a date or date and time without offset read as a wall time in loc
+// (UTC if nil), resolving wall times skipped or repeated by DST changes.
+func parseTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	wall, err := time.Parse(time.DateTime, value)
+	if err != nil {
+		wall, err = time.Parse(time.DateOnly, value)
+		if err != nil {
+			return time.Time{}, err
+		}
+	}
+
+	if loc == nil {
+		return wall, nil
+	}
+
+	return timestamp.ResolveWallTime(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), loc), nil
+}
@@ -0,0 +1,179 @@
+package compression
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Codec is a streaming compression format for output files.
+type Codec string
+
+const (
+	// Auto selects the codec from the file extension.
+	Auto Codec = ""
+	None Codec = "none"
+	Gzip Codec = "gzip"
+	Zstd Codec = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// ParseCodec parses a codec name as accepted on the command line: auto, none, gzip or zstd.
+func ParseCodec(name string) (Codec, error) {
+	switch c := Codec(name); c {
+	case None, Gzip, Zstd:
+		return c, nil
+	case Auto, "auto":
+		return Auto, nil
+	default:
+		return "", fmt.Errorf("unknown compression %q, want auto, none, gzip or zstd", name)
+	}
+}
+
+// FromPath returns the codec of a file extension: Gzip for .gz, Zstd for .zst and .zstd, None otherwise.
+func FromPath(path string) Codec {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".gz":
+		return Gzip
+	case ".zst", ".zstd":
+		return Zstd
+	default:
+		return None
+	}
+}
+
+// Resolve returns c, or the codec of path if c is Auto.
+func (c Codec) Resolve(path string) Codec {
+	if c == Auto {
+		return FromPath(path)
+	}
+
+	return c
+}
+
+// NewWriter returns a writer compressing into w with codec at level, which Close must be called on to
+// flush the stream; it does not close w. Level zero is the codec default; gzip takes 1 to 9, zstd 1 to 22,
+// and other levels are an error.
+func NewWriter(w io.Writer, codec Codec, level int) (io.WriteCloser, error) {
+	switch codec {
+	case None, Auto:
+		return nopCloser{w}, nil
+	case Gzip:
+		if level < 0 || level > 9 {
+			return nil, fmt.Errorf("invalid gzip compression level %d, want 1 to 9", level)
+		}
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		gw, err := gzip.NewWriterLevel(w, level)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip writer: %w", err)
+		}
+		return gw, nil
+	case Zstd:
+		// EncoderLevelFromZstd would silently clamp any level to the four levels the encoder implements.
+		if level < 0 || level > 22 {
+			return nil, fmt.Errorf("invalid zstd compression level %d, want 1 to 22", level)
+		}
+
+		options := []zstd.EOption{}
+		if level != 0 {
+			options = append(options, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+
+		zw, err := zstd.NewWriter(w, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd writer: %w", err)
+		}
+		return zw, nil
+	default:
+		return nil, fmt.Errorf("unknown compression %q", codec)
+	}
+}
+
+// Detect returns the codec of a stream from its first bytes, which should hold at least four bytes
+// unless the stream is shorter: Gzip or Zstd for their magic numbers and None otherwise.
+func Detect(header []byte) Codec {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return Zstd
+	default:
+		return None
+	}
+}
+
+// NewReader returns a reader of r that transparently decompresses gzip and zstd streams, recognized by
+// their magic number on the first Read, and passes anything else through. Concatenated streams, as
+// written when appending to a compressed file, are read as one.
+func NewReader(r io.Reader) io.ReadCloser {
+	return &reader{source: r}
+}
+
+type reader struct {
+	source io.Reader
+	r      io.Reader
+	closer func()
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if r.r == nil {
+		if err := r.detect(); err != nil {
+			return 0, err
+		}
+	}
+
+	return r.r.Read(p)
+}
+
+func (r *reader) detect() error {
+	buffered := bufio.NewReader(r.source)
+	magic, _ := buffered.Peek(len(zstdMagic))
+
+	switch Detect(magic) {
+	case Gzip:
+		gr, err := gzip.NewReader(buffered)
+		if err != nil {
+			return fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+		r.r, r.closer = gr, func() { gr.Close() }
+	case Zstd:
+		zr, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return fmt.Errorf("failed to read zstd stream: %w", err)
+		}
+		r.r, r.closer = zr, zr.Close
+	default:
+		r.r = buffered
+	}
+
+	return nil
+}
+
+// Close releases the decompressor; it does not close the underlying reader.
+func (r *reader) Close() error {
+	if r.closer != nil {
+		r.closer()
+	}
+
+	return nil
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
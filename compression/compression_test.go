@@ -0,0 +1,56 @@
+package compression
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestNewWriterLevels(t *testing.T) {
+	tests := []struct {
+		codec   Codec
+		level   int
+		wantErr bool
+	}{
+		{codec: Gzip, level: 0},
+		{codec: Gzip, level: 1},
+		{codec: Gzip, level: 9},
+		{codec: Gzip, level: 10, wantErr: true},
+		{codec: Gzip, level: -1, wantErr: true},
+		{codec: Zstd, level: 0},
+		{codec: Zstd, level: 1},
+		{codec: Zstd, level: 22},
+		{codec: Zstd, level: 23, wantErr: true},
+		{codec: Zstd, level: -1, wantErr: true},
+		{codec: None, level: 0},
+	}
+
+	input := strings.Repeat("compressible ", 100)
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		w, err := NewWriter(&buf, tt.codec, tt.level)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s level %d: NewWriter succeeded", tt.codec, tt.level)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s level %d: NewWriter: %v", tt.codec, tt.level, err)
+		}
+
+		io.WriteString(w, input)
+		if err := w.Close(); err != nil {
+			t.Fatalf("%s level %d: Close: %v", tt.codec, tt.level, err)
+		}
+
+		got, err := io.ReadAll(NewReader(&buf))
+		if err != nil {
+			t.Fatalf("%s level %d: read: %v", tt.codec, tt.level, err)
+		}
+		if string(got) != input {
+			t.Fatalf("%s level %d: the stream does not read back", tt.codec, tt.level)
+		}
+	}
+}
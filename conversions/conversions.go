@@ -1,14 +1,27 @@
 package conversions
 
 import (
+	"encoding"
 	"errors"
 	"fmt"
 	"reflect"
-	"strings"
+	"time"
 )
 
+// Marshaler is implemented by types that convert themselves to a map value.
+type Marshaler interface {
+	MarshalValue() (interface{}, error)
+}
+
+// Unmarshaler is implemented by types that set themselves from a map value.
+type Unmarshaler interface {
+	UnmarshalValue(value interface{}) error
+}
+
 // StructToMap converts a struct to a map[string]interface{} based on the provided tag name.
 // It handles nested structs and slices of structs recursively.
+// Tags may carry the options "-", "omitempty", "string" and "format=<time layout>";
+// values implementing Marshaler or encoding.TextMarshaler are converted by their own method.
 // Returns an error if the input is not a struct or pointer to a struct.
 func StructToMap(data interface{}, tagName string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
@@ -35,18 +48,18 @@ func StructToMap(data interface{}, tagName string) (map[string]interface{}, erro
 			continue
 		}
 
-		tagValue := field.Tag.Get(tagName)
-		var key string
-		if tagValue != "" {
-			key = strings.Split(tagValue, ",")[0] // Use the first part before any comma
-		} else {
-			key = field.Name
+		key, options, skip := parseTag(field, tagName)
+		if skip {
+			continue
 		}
 
-		fieldValue := v.Field(i).Interface()
+		fieldValue := v.Field(i)
+		if options.omitEmpty && fieldValue.IsZero() {
+			continue
+		}
 
 		// Handle nested structs, slices, and maps recursively
-		convertedValue, err := convertValue(fieldValue, tagName)
+		convertedValue, err := convertField(fieldValue.Interface(), tagName, options)
 		if err != nil {
 			return nil, fmt.Errorf("error converting field '%s': %v", field.Name, err)
 		}
@@ -57,6 +70,27 @@ func StructToMap(data interface{}, tagName string) (map[string]interface{}, erro
 	return result, nil
 }
 
+// convertField converts the value of a struct field, applying the options of its tag.
+func convertField(value interface{}, tagName string, options tagOptions) (interface{}, error) {
+	if t, ok := value.(time.Time); ok && options.format != "" {
+		return t.Format(options.format), nil
+	}
+
+	converted, err := convertValue(value, tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	if options.asString {
+		switch converted.(type) {
+		case bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+			return fmt.Sprint(converted), nil
+		}
+	}
+
+	return converted, nil
+}
+
 // convertValue recursively converts a value to map[string]interface{}, handling structs, slices, and maps.
 // Parameters:
 // - value: The value to convert.
@@ -66,6 +100,19 @@ func StructToMap(data interface{}, tagName string) (map[string]interface{}, erro
 // - The converted value.
 // - An error if the conversion fails.
 func convertValue(value interface{}, tagName string) (interface{}, error) {
+	switch v := value.(type) {
+	case Marshaler:
+		return v.MarshalValue()
+	case time.Time:
+		return v, nil
+	case encoding.TextMarshaler:
+		text, err := v.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(text), nil
+	}
+
 	val := reflect.ValueOf(value)
 
 	switch val.Kind() {
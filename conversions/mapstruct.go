@@ -0,0 +1,270 @@
+package conversions
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+var (
+	timeType        = reflect.TypeOf(time.Time{})
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textType        = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// MapToStruct is the reverse of StructToMap: it sets the fields of the struct out points to from the
+// keys of data named after the provided tag name, leaving fields without a key untouched.
+// Values are coerced to the field types: numbers and booleans from strings and other numeric types,
+// strings from any scalar, time.Time from a string in the tag format (RFC3339 by default) or from
+// Unix nanoseconds, nested structs from maps. Fields implementing Unmarshaler or
+// encoding.TextUnmarshaler, the latter from strings, set themselves.
+func MapToStruct(data map[string]interface{}, out interface{}, tagName string) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return errors.New("MapToStruct expects a non-nil pointer to a struct")
+	}
+
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return errors.New("MapToStruct expects a non-nil pointer to a struct")
+	}
+
+	return mapToStruct(data, v, tagName)
+}
+
+func mapToStruct(data map[string]interface{}, v reflect.Value, tagName string) error {
+	t := v.Type()
+	for i := 0; i < v.NumField(); i++ {
+		field := t.Field(i)
+
+		// Skip unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		key, options, skip := parseTag(field, tagName)
+		if skip {
+			continue
+		}
+
+		value, ok := data[key]
+		if !ok {
+			continue
+		}
+
+		if err := assign(v.Field(i), value, tagName, options); err != nil {
+			return fmt.Errorf("error converting field '%s': %v", field.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// assign sets dst from value, coercing it to the type of dst.
+func assign(dst reflect.Value, value interface{}, tagName string, options tagOptions) error {
+	if value == nil {
+		dst.SetZero()
+		return nil
+	}
+
+	if dst.CanAddr() && dst.Addr().Type().Implements(unmarshalerType) {
+		return dst.Addr().Interface().(Unmarshaler).UnmarshalValue(value)
+	}
+
+	src := reflect.ValueOf(value)
+	if dst.Type() == timeType {
+		return assignTime(dst, value, options)
+	}
+
+	if s, ok := value.(string); ok && dst.CanAddr() && dst.Addr().Type().Implements(textType) {
+		return dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+
+	switch dst.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(dst.Type().Elem())
+		if err := assign(elem.Elem(), value, tagName, options); err != nil {
+			return err
+		}
+		dst.Set(elem)
+	case reflect.String:
+		switch src.Kind() {
+		case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64, reflect.String:
+			dst.SetString(fmt.Sprint(value))
+		default:
+			return fmt.Errorf("cannot convert %T to string", value)
+		}
+	case reflect.Bool:
+		b, err := toBool(src)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := toInt(src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, dst.Type())
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := toUint(src)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, dst.Type())
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(src)
+		if err != nil {
+			return err
+		}
+		dst.SetFloat(f)
+	case reflect.Struct:
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("cannot convert %T to %s", value, dst.Type())
+		}
+		return mapToStruct(m, dst, tagName)
+	case reflect.Slice:
+		if src.Kind() != reflect.Slice && src.Kind() != reflect.Array {
+			return fmt.Errorf("cannot convert %T to %s", value, dst.Type())
+		}
+		slice := reflect.MakeSlice(dst.Type(), src.Len(), src.Len())
+		for i := 0; i < src.Len(); i++ {
+			if err := assign(slice.Index(i), src.Index(i).Interface(), tagName, tagOptions{}); err != nil {
+				return fmt.Errorf("element %d: %v", i, err)
+			}
+		}
+		dst.Set(slice)
+	case reflect.Map:
+		if dst.Type().Key().Kind() != reflect.String || src.Kind() != reflect.Map || src.Type().Key().Kind() != reflect.String {
+			return errors.New("only map with string keys are supported")
+		}
+		m := reflect.MakeMapWithSize(dst.Type(), src.Len())
+		iter := src.MapRange()
+		for iter.Next() {
+			elem := reflect.New(dst.Type().Elem()).Elem()
+			if err := assign(elem, iter.Value().Interface(), tagName, tagOptions{}); err != nil {
+				return fmt.Errorf("key %q: %v", iter.Key().String(), err)
+			}
+			m.SetMapIndex(reflect.ValueOf(iter.Key().String()).Convert(dst.Type().Key()), elem)
+		}
+		dst.Set(m)
+	default:
+		return fmt.Errorf("cannot convert %T to %s", value, dst.Type())
+	}
+
+	return nil
+}
+
+func assignTime(dst reflect.Value, value interface{}, options tagOptions) error {
+	switch v := value.(type) {
+	case time.Time:
+		dst.Set(reflect.ValueOf(v))
+	case string:
+		layout := options.format
+		if layout == "" {
+			layout = time.RFC3339Nano
+		}
+
+		t, err := time.Parse(layout, v)
+		if err != nil {
+			return err
+		}
+		dst.Set(reflect.ValueOf(t))
+	default:
+		nanos, err := toInt(reflect.ValueOf(value))
+		if err != nil {
+			return fmt.Errorf("cannot convert %T to time.Time", value)
+		}
+		dst.Set(reflect.ValueOf(time.Unix(0, nanos).UTC()))
+	}
+
+	return nil
+}
+
+func toBool(src reflect.Value) (bool, error) {
+	switch src.Kind() {
+	case reflect.Bool:
+		return src.Bool(), nil
+	case reflect.String:
+		return strconv.ParseBool(src.String())
+	default:
+		return false, fmt.Errorf("cannot convert %s to bool", src.Type())
+	}
+}
+
+func toInt(src reflect.Value) (int64, error) {
+	switch src.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return src.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if src.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%d overflows int64", src.Uint())
+		}
+		return int64(src.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := src.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%v is not an integer", f)
+		}
+		return int64(f), nil
+	case reflect.String:
+		return strconv.ParseInt(src.String(), 10, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %s to an integer", src.Type())
+	}
+}
+
+func toUint(src reflect.Value) (uint64, error) {
+	switch src.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if src.Int() < 0 {
+			return 0, fmt.Errorf("%d is negative", src.Int())
+		}
+		return uint64(src.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return src.Uint(), nil
+	case reflect.Float32, reflect.Float64:
+		f := src.Float()
+		if f != math.Trunc(f) || f < 0 || f >= math.MaxUint64 {
+			return 0, fmt.Errorf("%v is not an unsigned integer", f)
+		}
+		return uint64(f), nil
+	case reflect.String:
+		return strconv.ParseUint(src.String(), 10, 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %s to an unsigned integer", src.Type())
+	}
+}
+
+func toFloat(src reflect.Value) (float64, error) {
+	switch src.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(src.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(src.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return src.Float(), nil
+	case reflect.String:
+		return strconv.ParseFloat(src.String(), 64)
+	default:
+		return 0, fmt.Errorf("cannot convert %s to a float", src.Type())
+	}
+}
@@ -0,0 +1,209 @@
+package conversions
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// level converts itself through Marshaler and Unmarshaler.
+type level int
+
+func (l level) MarshalValue() (interface{}, error) {
+	return fmt.Sprintf("L%d", int(l)), nil
+}
+
+func (l *level) UnmarshalValue(value interface{}) error {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, "L") {
+		return fmt.Errorf("invalid level %v", value)
+	}
+
+	_, err := fmt.Sscanf(s, "L%d", (*int)(l))
+	return err
+}
+
+// side converts itself through encoding.TextMarshaler and encoding.TextUnmarshaler.
+type side struct {
+	buy bool
+}
+
+func (s side) MarshalText() ([]byte, error) {
+	if s.buy {
+		return []byte("buy"), nil
+	}
+	return []byte("sell"), nil
+}
+
+func (s *side) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "buy", "sell":
+		s.buy = string(text) == "buy"
+		return nil
+	default:
+		return fmt.Errorf("invalid side %q", text)
+	}
+}
+
+type quote struct {
+	Bid float64 `map:"bid"`
+	Ask float64 `map:"ask"`
+}
+
+type record struct {
+	Name     string           `map:"name"`
+	Count    int              `map:"count"`
+	Small    int8             `map:"small"`
+	Size     uint64           `map:"size"`
+	Ratio    float32          `map:"ratio"`
+	Enabled  bool             `map:"enabled"`
+	Time     time.Time        `map:"time"`
+	Day      time.Time        `map:"day,format=2006-01-02"`
+	Clock    time.Time        `map:"clock,format=15:04:05,000"`
+	Level    level            `map:"level"`
+	Side     side             `map:"side"`
+	Quote    quote            `map:"quote"`
+	Last     *quote           `map:"last"`
+	Quotes   []quote          `map:"quotes"`
+	Tags     []string         `map:"tags"`
+	Limits   map[string]int   `map:"limits"`
+	Books    map[string]quote `map:"books"`
+	Volume   int64            `map:"volume,string"`
+	Flag     bool             `map:"flag,string"`
+	Note     string           `map:"note,omitempty"`
+	Skipped  string           `map:"-"`
+	Dash     string           `map:"-,"`
+	Untagged string
+	Extra    map[string]string `map:"extra,omitempty"`
+}
+
+func TestMapToStructRoundTrip(t *testing.T) {
+	in := record{
+		Name:     "EURUSD",
+		Count:    -3,
+		Small:    -128,
+		Size:     math.MaxUint64,
+		Ratio:    0.5,
+		Enabled:  true,
+		Time:     time.Date(2024, 3, 10, 14, 30, 15, 123456789, time.UTC),
+		Day:      time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		Clock:    time.Date(0, 1, 1, 14, 30, 15, 0, time.UTC),
+		Level:    7,
+		Side:     side{buy: true},
+		Quote:    quote{Bid: 1.1, Ask: 1.2},
+		Last:     &quote{Bid: 1.3, Ask: 1.4},
+		Quotes:   []quote{{Bid: 1, Ask: 2}, {Bid: 3, Ask: 4}},
+		Tags:     []string{"a", "b"},
+		Limits:   map[string]int{"low": 1, "high": 9},
+		Books:    map[string]quote{"top": {Bid: 5, Ask: 6}},
+		Volume:   1 << 40,
+		Flag:     true,
+		Skipped:  "skipped",
+		Dash:     "dash",
+		Untagged: "untagged",
+	}
+
+	m, err := StructToMap(in, "map")
+	if err != nil {
+		t.Fatalf("StructToMap: %v", err)
+	}
+
+	for key, want := range map[string]interface{}{
+		"day":    "2024-03-10",
+		"clock":  "14:30:15,000",
+		"level":  "L7",
+		"side":   "buy",
+		"volume": "1099511627776",
+		"flag":   "true",
+	} {
+		if got := m[key]; got != want {
+			t.Errorf("key %q holds %#v, want %#v", key, got, want)
+		}
+	}
+	for _, key := range []string{"note", "extra", "Skipped"} {
+		if _, ok := m[key]; ok {
+			t.Errorf("key %q is present", key)
+		}
+	}
+
+	var out record
+	if err := MapToStruct(m, &out, "map"); err != nil {
+		t.Fatalf("MapToStruct: %v", err)
+	}
+
+	in.Skipped = ""
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("round trip changed the struct:\n got %+v\nwant %+v", out, in)
+	}
+}
+
+func TestMapToStructCoercion(t *testing.T) {
+	type target struct {
+		Int    int       `map:"int"`
+		Uint   uint16    `map:"uint"`
+		Big    uint64    `map:"big"`
+		Float  float64   `map:"float"`
+		Bool   bool      `map:"bool"`
+		String string    `map:"string"`
+		Time   time.Time `map:"time"`
+		Ptr    *int      `map:"ptr"`
+		Keep   string    `map:"keep"`
+	}
+
+	seven := 7
+	tests := []struct {
+		name    string
+		data    map[string]interface{}
+		want    target
+		wantErr bool
+	}{
+		{name: "numbers from strings", data: map[string]interface{}{"int": "-12", "uint": "65535", "big": "18446744073709551615", "float": "1.5", "bool": "true"},
+			want: target{Int: -12, Uint: math.MaxUint16, Big: math.MaxUint64, Float: 1.5, Bool: true}},
+		{name: "numbers from other numeric types", data: map[string]interface{}{"int": 3.0, "uint": int64(9), "big": uint64(math.MaxUint64), "float": 2},
+			want: target{Int: 3, Uint: 9, Big: math.MaxUint64, Float: 2}},
+		{name: "strings from scalars", data: map[string]interface{}{"string": 42}, want: target{String: "42"}},
+		{name: "time from unix nanoseconds", data: map[string]interface{}{"time": int64(1_700_000_000_000_000_000)},
+			want: target{Time: time.Unix(0, 1_700_000_000_000_000_000).UTC()}},
+		{name: "pointer", data: map[string]interface{}{"ptr": "7"}, want: target{Ptr: &seven}},
+		{name: "nil clears the field", data: map[string]interface{}{"keep": nil}},
+		{name: "negative unsigned", data: map[string]interface{}{"uint": -1}, wantErr: true},
+		{name: "unsigned overflow", data: map[string]interface{}{"uint": "65536"}, wantErr: true},
+		{name: "fractional integer", data: map[string]interface{}{"int": 1.5}, wantErr: true},
+		{name: "invalid time", data: map[string]interface{}{"time": "yesterday"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := target{Keep: "kept"}
+			if _, ok := tt.data["keep"]; !ok {
+				tt.want.Keep = "kept"
+			}
+
+			err := MapToStruct(tt.data, &out, "map")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("MapToStruct succeeded with %+v", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("MapToStruct: %v", err)
+			}
+			if !reflect.DeepEqual(out, tt.want) {
+				t.Fatalf("got %+v, want %+v", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestMapToStructRejectsNonStruct(t *testing.T) {
+	var n int
+	for _, out := range []interface{}{nil, record{}, &n, (*record)(nil)} {
+		if err := MapToStruct(map[string]interface{}{}, out, "map"); err == nil {
+			t.Errorf("MapToStruct accepted %T", out)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package conversions
+
+import (
+	"encoding"
+	"errors"
+	"reflect"
+	"sync"
+	"unsafe"
+)
+
+// Field is a top-level field of T, resolved once by a FieldPlan. Its accessors read the field of a row
+// directly, without per-row reflection or allocation; they panic if the field is not of the accessor's kind.
+type Field[T any] struct {
+	// Name is the key of the field for the plan's tag name.
+	Name string
+	// Kind is the kind of the field type.
+	Kind reflect.Kind
+	// Type is the field type.
+	Type reflect.Type
+	// OmitEmpty reports whether the tag carries the omitempty option.
+	OmitEmpty bool
+	// Converted reports whether StructToMap stores something else than the raw value: the tag carries the
+	// string or format= option, or the type implements Marshaler or encoding.TextMarshaler. Use Convert then.
+	Converted bool
+
+	offset  uintptr
+	tagName string
+	options tagOptions
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// converted reports whether convertField changes values of type t beyond returning them.
+func converted(t reflect.Type, options tagOptions) bool {
+	if options.asString || options.format != "" {
+		return true
+	}
+
+	// Times are kept as is unless a format is set, although they implement encoding.TextMarshaler.
+	return t.Implements(marshalerType) || (t != timeType && t.Implements(textMarshalerType))
+}
+
+func (f Field[T]) pointer(row *T) unsafe.Pointer {
+	return unsafe.Add(unsafe.Pointer(row), f.offset)
+}
+
+// String returns the value of a string field.
+func (f Field[T]) String(row *T) string {
+	f.check(reflect.String)
+	return *(*string)(f.pointer(row))
+}
+
+// Bool returns the value of a bool field.
+func (f Field[T]) Bool(row *T) bool {
+	f.check(reflect.Bool)
+	return *(*bool)(f.pointer(row))
+}
+
+// Int returns the value of a signed integer field.
+func (f Field[T]) Int(row *T) int64 {
+	p := f.pointer(row)
+	switch f.Kind {
+	case reflect.Int:
+		return int64(*(*int)(p))
+	case reflect.Int8:
+		return int64(*(*int8)(p))
+	case reflect.Int16:
+		return int64(*(*int16)(p))
+	case reflect.Int32:
+		return int64(*(*int32)(p))
+	case reflect.Int64:
+		return *(*int64)(p)
+	}
+
+	panic("conversions: Int of " + f.Kind.String() + " field " + f.Name)
+}
+
+// Uint returns the value of an unsigned integer field.
+func (f Field[T]) Uint(row *T) uint64 {
+	p := f.pointer(row)
+	switch f.Kind {
+	case reflect.Uint:
+		return uint64(*(*uint)(p))
+	case reflect.Uint8:
+		return uint64(*(*uint8)(p))
+	case reflect.Uint16:
+		return uint64(*(*uint16)(p))
+	case reflect.Uint32:
+		return uint64(*(*uint32)(p))
+	case reflect.Uint64:
+		return *(*uint64)(p)
+	}
+
+	panic("conversions: Uint of " + f.Kind.String() + " field " + f.Name)
+}
+
+// Float returns the value of a float field.
+func (f Field[T]) Float(row *T) float64 {
+	p := f.pointer(row)
+	switch f.Kind {
+	case reflect.Float32:
+		return float64(*(*float32)(p))
+	case reflect.Float64:
+		return *(*float64)(p)
+	}
+
+	panic("conversions: Float of " + f.Kind.String() + " field " + f.Name)
+}
+
+// Value returns the value of a field of any kind. Unlike the typed accessors it allocates.
+func (f Field[T]) Value(row *T) interface{} {
+	return reflect.NewAt(f.Type, f.pointer(row)).Elem().Interface()
+}
+
+// Convert returns the value StructToMap stores for the field, after its tag options and conversion hooks.
+func (f Field[T]) Convert(row *T) (interface{}, error) {
+	return convertField(f.Value(row), f.tagName, f.options)
+}
+
+func (f Field[T]) check(kind reflect.Kind) {
+	if f.Kind != kind {
+		panic("conversions: " + kind.String() + " of " + f.Kind.String() + " field " + f.Name)
+	}
+}
+
+// FieldPlan lists the exported top-level fields of the struct type T in declaration order,
+// keyed like StructToMap keys them for a tag name. Plans are computed once per type and tag name.
+type FieldPlan[T any] struct {
+	Fields []Field[T]
+	index  map[string]int
+}
+
+type planKey struct {
+	typ     reflect.Type
+	tagName string
+}
+
+var plans sync.Map
+
+// PlanFor returns the field plan of T for tagName, which is computed on first use and then cached.
+func PlanFor[T any](tagName string) (*FieldPlan[T], error) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	key := planKey{typ: t, tagName: tagName}
+	if plan, ok := plans.Load(key); ok {
+		return plan.(*FieldPlan[T]), nil
+	}
+
+	if t.Kind() != reflect.Struct {
+		return nil, errors.New("PlanFor expects a struct type")
+	}
+
+	plan := &FieldPlan[T]{index: make(map[string]int)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		// Skip unexported fields
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name, options, skip := parseTag(field, tagName)
+		if skip {
+			continue
+		}
+
+		plan.index[name] = len(plan.Fields)
+		plan.Fields = append(plan.Fields, Field[T]{
+			Name:      name,
+			Kind:      field.Type.Kind(),
+			Type:      field.Type,
+			OmitEmpty: options.omitEmpty,
+			Converted: converted(field.Type, options),
+			offset:    field.Offset,
+			tagName:   tagName,
+			options:   options,
+		})
+	}
+
+	actual, _ := plans.LoadOrStore(key, plan)
+	return actual.(*FieldPlan[T]), nil
+}
+
+// Field returns the field named name.
+func (p *FieldPlan[T]) Field(name string) (Field[T], bool) {
+	i, ok := p.index[name]
+	if !ok {
+		return Field[T]{}, false
+	}
+
+	return p.Fields[i], true
+}
+
+// Names returns the names of the fields, in order.
+func (p *FieldPlan[T]) Names() []string {
+	names := make([]string, len(p.Fields))
+	for i, f := range p.Fields {
+		names[i] = f.Name
+	}
+
+	return names
+}
@@ -0,0 +1,51 @@
+package conversions
+
+import (
+	"reflect"
+	"strings"
+)
+
+// tagOptions holds the options following the name in a struct tag, e.g. `csv:"time,omitempty,format=15:04:05"`.
+type tagOptions struct {
+	// omitEmpty leaves zero values out of the map.
+	omitEmpty bool
+	// asString renders numbers and booleans as strings.
+	asString bool
+	// format is the time layout of a time.Time field.
+	format string
+}
+
+// parseTag returns the key and options of field for tagName. skip is true for fields tagged "-",
+// which are left out of both conversions; use "-," for a key named "-".
+func parseTag(field reflect.StructField, tagName string) (key string, options tagOptions, skip bool) {
+	tagValue := field.Tag.Get(tagName)
+	if tagValue == "-" {
+		return "", tagOptions{}, true
+	}
+
+	key, rest, _ := strings.Cut(tagValue, ",")
+	if key == "" {
+		key = field.Name
+	}
+
+	for rest != "" {
+		var option string
+		option, rest, _ = strings.Cut(rest, ",")
+
+		switch {
+		case option == "omitempty":
+			options.omitEmpty = true
+		case option == "string":
+			options.asString = true
+		case strings.HasPrefix(option, "format="):
+			// A layout may itself contain commas, so the format option takes the rest of the tag.
+			options.format = strings.TrimPrefix(option, "format=")
+			if rest != "" {
+				options.format += "," + rest
+			}
+			rest = ""
+		}
+	}
+
+	return key, options, false
+}
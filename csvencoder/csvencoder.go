@@ -1,7 +1,6 @@
 package csvencoder
 
 import (
-	"encoding/csv"
 	"fmt"
 	"io"
 	"sort"
@@ -41,11 +40,18 @@ func (e *CSVEncoder) flattenMap(m map[string]interface{}, prefix string) map[str
 	return result
 }
 
-func (e *CSVEncoder) generateHeaders(data []map[string]interface{}) {
+// Encode writes data as CSV with one column per flattened key, sorted alphabetically, and values
+// rendered with %v. It is a compatibility layer over Writer; nothing is written for empty data.
+func (e *CSVEncoder) Encode(w io.Writer, data []map[string]interface{}) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	rows := make([]map[string]interface{}, len(data))
 	headerSet := make(map[string]bool)
-	for _, item := range data {
-		flatItem := e.flattenMap(item, "")
-		for k := range flatItem {
+	for i, item := range data {
+		rows[i] = e.flattenMap(item, "")
+		for k := range rows[i] {
 			headerSet[k] = true
 		}
 	}
@@ -55,56 +61,22 @@ func (e *CSVEncoder) generateHeaders(data []map[string]interface{}) {
 		e.headers = append(e.headers, k)
 	}
 	sort.Strings(e.headers)
-}
-
-func (e *CSVEncoder) convertToMatrix(data []map[string]interface{}) [][]interface{} {
-	if len(data) == 0 {
-		return nil
-	}
-
-	e.generateHeaders(data)
-	matrix := make([][]interface{}, len(data)+1)
 
-	// Add headers as the first row
-	matrix[0] = make([]interface{}, len(e.headers))
+	schema := make(Schema[map[string]interface{}], len(e.headers))
 	for i, header := range e.headers {
-		matrix[0][i] = header
+		schema[i] = StringColumn(header, func(row map[string]interface{}) string {
+			return fmt.Sprintf("%v", row[header])
+		})
 	}
 
-	// Add data rows
-	for i, item := range data {
-		flatItem := e.flattenMap(item, "")
-		row := make([]interface{}, len(e.headers))
-		for j, header := range e.headers {
-			row[j] = flatItem[header]
-		}
-		matrix[i+1] = row
-	}
-
-	return matrix
-}
-
-func (e *CSVEncoder) Encode(w io.Writer, data []map[string]interface{}) error {
-	matrix := e.convertToMatrix(data)
-	if matrix == nil {
-		return nil
-	}
-
-	csvWriter := csv.NewWriter(w)
-	csvWriter.Comma = e.separator
-
-	for _, row := range matrix {
-		stringRow := make([]string, len(row))
-		for i, cell := range row {
-			stringRow[i] = fmt.Sprintf("%v", cell)
-		}
-		if err := csvWriter.Write(stringRow); err != nil {
+	cw := NewWriter(w, schema).WithSeparator(e.separator)
+	for _, row := range rows {
+		if err := cw.WriteRow(row); err != nil {
 			return err
 		}
 	}
 
-	csvWriter.Flush()
-	return csvWriter.Error()
+	return cw.Flush()
 }
 
 func (e *CSVEncoder) EncodeToString(data []map[string]interface{}) (string, error) {
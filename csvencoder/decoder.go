@@ -0,0 +1,220 @@
+package csvencoder
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/compression"
+	"github.com/condrove10/dukascopy-downloader/conversions"
+	"github.com/condrove10/dukascopy-downloader/cursor"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+	"io"
+	"iter"
+	"reflect"
+	"strings"
+)
+
+// tickFields maps the csv tag of every tick.Tick field to whether it holds a float.
+var tickFields = func() map[string]bool {
+	fields := make(map[string]bool)
+	t := reflect.TypeOf(tick.Tick{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("csv"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		fields[name] = t.Field(i).Type.Kind() == reflect.Float64
+	}
+
+	return fields
+}()
+
+// Decoder reads ticks back from CSV with a header row, such as the files written by the tick sinks.
+// Columns are matched to tick.Tick fields by their csv tag; unknown columns are ignored.
+type Decoder struct {
+	source     io.Reader
+	separator  rune
+	decompress bool
+	reader     *csv.Reader
+	timestamp  timestamp.Format
+	locale     Locale
+	headers    map[string]string
+	symbol     string
+
+	header     []string
+	fields     map[string]int
+	timeFields []int
+	line       int
+}
+
+// NewDecoder returns a Decoder reading ',' separated fields with Unix nanosecond timestamps.
+// Gzip and zstd compressed input is decompressed transparently.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		source:     r,
+		separator:  ',',
+		decompress: true,
+	}
+}
+
+func (d *Decoder) WithSeparator(separator rune) *Decoder {
+	d.separator = separator
+	return d
+}
+
+// WithDecompression sets whether compressed input is detected and decompressed; disable it for
+// input that was already decompressed.
+func (d *Decoder) WithDecompression(decompress bool) *Decoder {
+	d.decompress = decompress
+	return d
+}
+
+// WithTimestampFormat sets how the timestamp column, or the date and time columns, are read.
+func (d *Decoder) WithTimestampFormat(format timestamp.Format) *Decoder {
+	d.timestamp = format
+	return d
+}
+
+// WithLocale sets the decimal and thousands separators prices and volumes are written with.
+func (d *Decoder) WithLocale(locale Locale) *Decoder {
+	d.locale = locale
+	return d
+}
+
+// WithHeaders maps renamed headers back to csv tag names, the inverse of Schema.Rename.
+func (d *Decoder) WithHeaders(headers map[string]string) *Decoder {
+	d.headers = headers
+	return d
+}
+
+// WithSymbol sets the symbol of the ticks read from files without a symbol column.
+func (d *Decoder) WithSymbol(symbol string) *Decoder {
+	d.symbol = symbol
+	return d
+}
+
+// Header returns the header row, reading it if no tick was decoded yet.
+func (d *Decoder) Header() ([]string, error) {
+	if d.fields == nil {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	return d.header, nil
+}
+
+// Decode reads the next tick. It returns io.EOF once the input is exhausted.
+func (d *Decoder) Decode() (*tick.Tick, error) {
+	if d.fields == nil {
+		if err := d.readHeader(); err != nil {
+			return nil, err
+		}
+	}
+
+	record, err := d.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, io.EOF
+		}
+
+		return nil, fmt.Errorf("failed to read csv: %w", err)
+	}
+	d.line++
+
+	values := make([]string, len(d.timeFields))
+	for i, column := range d.timeFields {
+		values[i] = record[column]
+	}
+
+	nanos, err := d.timestamp.Parse(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode row %d: %w", d.line, err)
+	}
+
+	m := make(map[string]interface{}, len(d.fields)+1)
+	for name, column := range d.fields {
+		if tickFields[name] {
+			m[name] = d.locale.delocalize(record[column])
+			continue
+		}
+		m[name] = record[column]
+	}
+	m["timestamp"] = nanos
+
+	t := tick.New().WithSymbol(d.symbol)
+	if err := conversions.MapToStruct(m, t, "csv"); err != nil {
+		return nil, fmt.Errorf("failed to decode row %d: %w", d.line, err)
+	}
+
+	return t, nil
+}
+
+// All returns an iterator over the remaining ticks; a decoding failure is yielded as the last element.
+func (d *Decoder) All() iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		for {
+			t, err := d.Decode()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if !yield(t, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Cursor returns a cursor over the remaining ticks, so decoded files can stand in for a download.
+func (d *Decoder) Cursor(bufferSize int) *cursor.Cursor {
+	return cursor.FromSeq(d.All(), bufferSize)
+}
+
+func (d *Decoder) readHeader() error {
+	source := d.source
+	if d.decompress {
+		source = compression.NewReader(source)
+	}
+
+	d.reader = csv.NewReader(source)
+	d.reader.Comma = d.separator
+	d.reader.ReuseRecord = true
+
+	header, err := d.reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	d.header = append([]string(nil), header...)
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if renamed, ok := d.headers[name]; ok {
+			name = renamed
+		}
+		columns[name] = i
+	}
+
+	d.fields = make(map[string]int)
+	for name := range tickFields {
+		if column, ok := columns[name]; ok && name != "timestamp" {
+			d.fields[name] = column
+		}
+	}
+
+	for _, name := range d.timestamp.Columns("timestamp") {
+		column, ok := columns[name]
+		if !ok {
+			return fmt.Errorf("missing timestamp column %q", name)
+		}
+		d.timeFields = append(d.timeFields, column)
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+package csvencoder_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/condrove10/dukascopy-downloader/csvencoder"
+	"github.com/condrove10/dukascopy-downloader/sink"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+)
+
+func sampleTicks() []*tick.Tick {
+	start := time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC)
+	return []*tick.Tick{
+		{Symbol: "EURUSD", Timestamp: start.Add(123 * time.Millisecond).UnixNano(), Ask: 1.08123, Bid: 1.08119, VolumeAsk: 1234567.25, VolumeBid: 0.5},
+		{Symbol: "EURUSD", Timestamp: start.Add(1500 * time.Millisecond).UnixNano(), Ask: 1.08125, Bid: 1.0812, VolumeAsk: 3, VolumeBid: 1000},
+		{Symbol: "GBPUSD", Timestamp: start.Add(time.Hour + 7*time.Millisecond).UnixNano(), Ask: 1.2701, Bid: 1.26995, VolumeAsk: 0.01, VolumeBid: 12.75},
+	}
+}
+
+// export writes ticks with a CSV sink and returns its output.
+func export(t *testing.T, ticks []*tick.Tick, options sink.CSVOptions) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	s, err := sink.NewCSV(&buf, options)
+	if err != nil {
+		t.Fatalf("NewCSV: %v", err)
+	}
+	for _, tk := range ticks {
+		if err := s.Write(tk); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+// decodeAll reads every tick of d.
+func decodeAll(t *testing.T, d *csvencoder.Decoder) []*tick.Tick {
+	t.Helper()
+
+	var ticks []*tick.Tick
+	for tk, err := range d.All() {
+		if err != nil {
+			t.Fatalf("Decode: %v", err)
+		}
+		ticks = append(ticks, tk)
+	}
+
+	return ticks
+}
+
+// rounded returns ticks with the timestamps an export in format reads back.
+func rounded(t *testing.T, ticks []*tick.Tick, format timestamp.Format) []*tick.Tick {
+	t.Helper()
+
+	want := make([]*tick.Tick, len(ticks))
+	for i, tk := range ticks {
+		nanos, err := format.Round(tk.Timestamp)
+		if err != nil {
+			t.Fatalf("Round: %v", err)
+		}
+		cp := *tk
+		cp.Timestamp = nanos
+		want[i] = &cp
+	}
+
+	return want
+}
+
+func wantTicks(t *testing.T, got []*tick.Tick, want []*tick.Tick) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d ticks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Fatalf("tick %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("LoadLocation: %v", err)
+	}
+
+	formats := []struct {
+		name   string
+		format timestamp.Format
+	}{
+		{name: "unix_ns", format: timestamp.Format{Kind: timestamp.UnixNanos}},
+		{name: "unix_ms", format: timestamp.Format{Kind: timestamp.UnixMillis}},
+		{name: "unix_s", format: timestamp.Format{Kind: timestamp.UnixSeconds}},
+		{name: "rfc3339", format: timestamp.Format{Kind: timestamp.RFC3339, Precision: -1}},
+		{name: "rfc3339 in Berlin", format: timestamp.Format{Kind: timestamp.RFC3339, Precision: 3, Location: berlin}},
+		{name: "split", format: timestamp.Format{Kind: timestamp.Split, Precision: 3}},
+		{name: "split in Berlin", format: timestamp.Format{Kind: timestamp.Split, Precision: -1, Location: berlin}},
+		{name: "layout", format: timestamp.Format{Kind: timestamp.Layout, Layout: "02.01.2006 15:04:05.000"}},
+	}
+
+	locales := []struct {
+		name      string
+		locale    csvencoder.Locale
+		separator rune
+	}{
+		{name: "default"},
+		{name: "decimal comma", locale: csvencoder.Locale{Decimal: ','}},
+		{name: "grouped decimal comma", locale: csvencoder.Locale{Decimal: ',', Thousands: '.'}},
+		{name: "grouped decimal point", locale: csvencoder.Locale{Thousands: ','}, separator: '\t'},
+	}
+
+	for _, f := range formats {
+		for _, l := range locales {
+			t.Run(f.name+"/"+l.name, func(t *testing.T) {
+				options := sink.CSVOptions{Timestamp: f.format, Locale: l.locale, Separator: l.separator}
+				data := export(t, sampleTicks(), options)
+
+				separator := l.separator
+				if separator == 0 {
+					separator = l.locale.FieldSeparator()
+				}
+				d := csvencoder.NewDecoder(bytes.NewReader(data)).
+					WithSeparator(separator).
+					WithTimestampFormat(f.format).
+					WithLocale(l.locale)
+
+				wantTicks(t, decodeAll(t, d), rounded(t, sampleTicks(), f.format))
+			})
+		}
+	}
+}
+
+func TestDecoderHeaders(t *testing.T) {
+	format := timestamp.Format{Kind: timestamp.Split, Precision: 3}
+	options := sink.CSVOptions{
+		Timestamp: format,
+		Columns:   []string{"date", "time", "bid", "ask"},
+		Headers:   map[string]string{"date": "Day", "time": "Time", "bid": "Bid price"},
+	}
+	data := export(t, sampleTicks()[:2], options)
+
+	if header, _, _ := strings.Cut(string(data), "\n"); header != "Day,Time,Bid price,ask" {
+		t.Fatalf("got header %q", header)
+	}
+
+	d := csvencoder.NewDecoder(bytes.NewReader(data)).
+		WithTimestampFormat(format).
+		WithHeaders(map[string]string{"Day": "date", "Time": "time", "Bid price": "bid"}).
+		WithSymbol("EURUSD")
+
+	header, err := d.Header()
+	if err != nil {
+		t.Fatalf("Header: %v", err)
+	}
+	if !reflect.DeepEqual(header, []string{"Day", "Time", "Bid price", "ask"}) {
+		t.Fatalf("got header %v", header)
+	}
+
+	var want []*tick.Tick
+	for _, tk := range rounded(t, sampleTicks()[:2], format) {
+		want = append(want, &tick.Tick{Symbol: tk.Symbol, Timestamp: tk.Timestamp, Ask: tk.Ask, Bid: tk.Bid})
+	}
+	wantTicks(t, decodeAll(t, d), want)
+
+	// Without the renames the timestamp columns cannot be found.
+	if _, err := csvencoder.NewDecoder(bytes.NewReader(data)).WithTimestampFormat(format).Decode(); err == nil {
+		t.Fatal("Decode found renamed timestamp columns without WithHeaders")
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "missing timestamp column", input: "symbol,ask\nEURUSD,1\n"},
+		{name: "invalid timestamp", input: "timestamp,ask\nyesterday,1\n"},
+		{name: "invalid price", input: "timestamp,ask\n1,one\n"},
+		{name: "short row", input: "timestamp,ask\n1\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := csvencoder.NewDecoder(strings.NewReader(tt.input)).Decode()
+			if err == nil || errors.Is(err, io.EOF) {
+				t.Fatalf("got %v, want a decoding error", err)
+			}
+		})
+	}
+
+	if _, err := csvencoder.NewDecoder(strings.NewReader("")).Decode(); !errors.Is(err, io.EOF) {
+		t.Fatalf("empty input: got %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderCursor(t *testing.T) {
+	data := export(t, sampleTicks(), sink.CSVOptions{})
+
+	c := csvencoder.NewDecoder(bytes.NewReader(data)).Cursor(1)
+	var got []*tick.Tick
+	for tk, err := range c.All(context.Background()) {
+		if err != nil {
+			t.Fatalf("cursor: %v", err)
+		}
+		got = append(got, tk)
+	}
+	wantTicks(t, got, sampleTicks())
+
+	// A decoding failure ends the cursor with the error.
+	bad := fmt.Sprintf("%s\nEURUSD,not-a-timestamp,1,1,1,1\n", bytes.TrimSpace(data))
+	c = csvencoder.NewDecoder(strings.NewReader(bad)).Cursor(1)
+	var n int
+	for c.Next(context.Background()) {
+		n++
+	}
+	if n != len(sampleTicks()) || c.Error() == nil {
+		t.Fatalf("got %d ticks and error %v, want %d ticks and a decoding error", n, c.Error(), len(sampleTicks()))
+	}
+}
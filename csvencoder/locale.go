@@ -0,0 +1,120 @@
+package csvencoder
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Locale describes how float columns write their decimal and thousands separators.
+// The zero Locale writes a '.' decimal point and no thousands separator.
+type Locale struct {
+	// Decimal is the decimal separator; zero means '.'.
+	Decimal rune
+	// Thousands separates groups of three integer digits; zero means none.
+	Thousands rune
+}
+
+// ParseLocale returns the locale of a language tag such as "en", "de", "fr-FR" or "it_IT", for the
+// languages whose spreadsheets expect a decimal comma and otherwise a decimal point.
+func ParseLocale(tag string) (Locale, error) {
+	language, _, _ := strings.Cut(strings.ReplaceAll(strings.ToLower(tag), "_", "-"), "-")
+
+	switch language {
+	case "", "c", "en", "ja", "ko", "zh":
+		return Locale{}, nil
+	case "de", "fr", "it", "es", "nl", "pt", "pl", "da", "sv", "nb", "fi", "cs", "ru", "tr":
+		return Locale{Decimal: ','}, nil
+	default:
+		return Locale{}, fmt.Errorf("unknown locale %q", tag)
+	}
+}
+
+// FieldSeparator returns the field separator spreadsheets configured for the locale expect:
+// ';' with a decimal comma and ',' otherwise.
+func (l Locale) FieldSeparator() rune {
+	if l.decimal() == ',' {
+		return ';'
+	}
+
+	return ','
+}
+
+func (l Locale) decimal() rune {
+	if l.Decimal == 0 {
+		return '.'
+	}
+
+	return l.Decimal
+}
+
+func (l Locale) isDefault() bool {
+	return l.decimal() == '.' && l.Thousands == 0
+}
+
+// validate rejects locales whose separators could not be told apart from each other or from separator.
+func (l Locale) validate(separator rune) error {
+	decimal := l.decimal()
+	if decimal == separator || l.Thousands == separator {
+		return fmt.Errorf("locale separators must differ from the field separator %q", separator)
+	}
+
+	if decimal == l.Thousands {
+		return fmt.Errorf("locale decimal and thousands separators must differ")
+	}
+
+	if !utf8.ValidRune(decimal) || (l.Thousands != 0 && !utf8.ValidRune(l.Thousands)) {
+		return fmt.Errorf("invalid locale separator")
+	}
+
+	return nil
+}
+
+// localize appends number, a float rendered by strconv, with the separators of the locale.
+func (l Locale) localize(dst []byte, number []byte) []byte {
+	if l.isDefault() {
+		return append(dst, number...)
+	}
+
+	i := 0
+	if i < len(number) && (number[i] == '-' || number[i] == '+') {
+		dst = append(dst, number[i])
+		i++
+	}
+
+	// Digits of the integer part, which NaN and Inf do not have.
+	end := i
+	for end < len(number) && number[end] >= '0' && number[end] <= '9' {
+		end++
+	}
+
+	for j := i; j < end; j++ {
+		if l.Thousands != 0 && j > i && (end-j)%3 == 0 {
+			dst = utf8.AppendRune(dst, l.Thousands)
+		}
+		dst = append(dst, number[j])
+	}
+
+	for _, c := range number[end:] {
+		if c == '.' {
+			dst = utf8.AppendRune(dst, l.decimal())
+			continue
+		}
+		dst = append(dst, c)
+	}
+
+	return dst
+}
+
+// delocalize rewrites a float written with the separators of the locale for strconv.ParseFloat.
+func (l Locale) delocalize(value string) string {
+	if l.isDefault() {
+		return value
+	}
+
+	if l.Thousands != 0 {
+		value = strings.ReplaceAll(value, string(l.Thousands), "")
+	}
+
+	return strings.ReplaceAll(value, string(l.decimal()), ".")
+}
@@ -0,0 +1,159 @@
+package csvencoder
+
+import (
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/conversions"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+	"reflect"
+)
+
+// Column extracts one CSV field from a row of type T. Build columns with StringColumn, IntColumn,
+// FloatColumn or ValueColumn.
+type Column[T any] struct {
+	// Header is the name written in the header row.
+	Header string
+
+	str     func(T) string
+	integer func(T) int64
+	float   func(T) float64
+	value   func(T) interface{}
+	convert func(T) (interface{}, error)
+}
+
+func StringColumn[T any](header string, fn func(T) string) Column[T] {
+	return Column[T]{Header: header, str: fn}
+}
+
+func IntColumn[T any](header string, fn func(T) int64) Column[T] {
+	return Column[T]{Header: header, integer: fn}
+}
+
+// FloatColumn returns a column rendered with the float format of the Writer.
+func FloatColumn[T any](header string, fn func(T) float64) Column[T] {
+	return Column[T]{Header: header, float: fn}
+}
+
+// ValueColumn returns a column whose values are rendered by dynamic type: integers and floats like
+// IntColumn and FloatColumn, anything else with %v.
+func ValueColumn[T any](header string, fn func(T) interface{}) Column[T] {
+	return Column[T]{Header: header, value: fn}
+}
+
+// ConvertColumn returns a column rendered like ValueColumn from values fn may fail to produce;
+// WriteRow returns the error.
+func ConvertColumn[T any](header string, fn func(T) (interface{}, error)) Column[T] {
+	return Column[T]{Header: header, convert: fn}
+}
+
+// Schema is the ordered list of columns a Writer encodes.
+type Schema[T any] []Column[T]
+
+// Headers returns the header of every column, in order.
+func (s Schema[T]) Headers() []string {
+	headers := make([]string, len(s))
+	for i, c := range s {
+		headers[i] = c.Header
+	}
+
+	return headers
+}
+
+// Select returns a schema holding the columns with the given headers, in the given order.
+func (s Schema[T]) Select(headers ...string) (Schema[T], error) {
+	selected := make(Schema[T], 0, len(headers))
+	for _, h := range headers {
+		found := false
+		for _, c := range s {
+			if c.Header == h {
+				selected = append(selected, c)
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil, fmt.Errorf("unknown column %q", h)
+		}
+	}
+
+	return selected, nil
+}
+
+// Rename returns a copy of the schema with the headers found in names replaced by their value.
+func (s Schema[T]) Rename(names map[string]string) Schema[T] {
+	renamed := make(Schema[T], len(s))
+	for i, c := range s {
+		if name, ok := names[c.Header]; ok {
+			c.Header = name
+		}
+		renamed[i] = c
+	}
+
+	return renamed
+}
+
+// SchemaFor returns a column for every exported field of the struct type T, named and ordered like the
+// fields of conversions.PlanFor. Values are read through the plan, without per-row reflection for
+// string, integer and float fields. Other fields, and fields with tag options or conversion hooks,
+// are rendered from the value StructToMap would store for them.
+func SchemaFor[T any](tagName string) (Schema[*T], error) {
+	plan, err := conversions.PlanFor[T](tagName)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := make(Schema[*T], len(plan.Fields))
+	for i, f := range plan.Fields {
+		if f.Converted {
+			schema[i] = ConvertColumn(f.Name, f.Convert)
+			continue
+		}
+
+		switch f.Kind {
+		case reflect.String:
+			schema[i] = StringColumn(f.Name, f.String)
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			schema[i] = IntColumn(f.Name, f.Int)
+		case reflect.Float32, reflect.Float64:
+			schema[i] = FloatColumn(f.Name, f.Float)
+		default:
+			schema[i] = ConvertColumn(f.Name, f.Convert)
+		}
+	}
+
+	return schema, nil
+}
+
+// TickSchema returns the columns of tick.Tick, named after its csv tags and in field order,
+// with the timestamp rendered by ts into one or more columns.
+func TickSchema(ts timestamp.Format) Schema[*tick.Tick] {
+	fields, err := SchemaFor[tick.Tick]("csv")
+	if err != nil {
+		panic(err)
+	}
+
+	schema := make(Schema[*tick.Tick], 0, len(fields)+1)
+	for _, c := range fields {
+		if c.Header != "timestamp" {
+			schema = append(schema, c)
+			continue
+		}
+
+		if _, ok := ts.Unix(0); ok {
+			schema = append(schema, IntColumn(c.Header, func(t *tick.Tick) int64 {
+				unix, _ := ts.Unix(t.Timestamp)
+				return unix
+			}))
+			continue
+		}
+
+		for i, name := range ts.Columns(c.Header) {
+			schema = append(schema, ValueColumn(name, func(t *tick.Tick) interface{} {
+				return ts.Values(t.Timestamp)[i]
+			}))
+		}
+	}
+
+	return schema
+}
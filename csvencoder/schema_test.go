@@ -0,0 +1,72 @@
+package csvencoder
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level int
+
+func (l level) MarshalText() ([]byte, error) {
+	return []byte(strings.Repeat("*", int(l))), nil
+}
+
+type failing struct{}
+
+var errMarshal = errors.New("cannot marshal")
+
+func (failing) MarshalValue() (interface{}, error) {
+	return nil, errMarshal
+}
+
+type row struct {
+	Name    string    `csv:"name"`
+	Count   int       `csv:"count,string"`
+	Day     time.Time `csv:"day,format=2006-01-02"`
+	At      time.Time `csv:"at"`
+	Level   level     `csv:"level"`
+	Price   float64   `csv:"price"`
+	Pointer *int      `csv:"pointer"`
+}
+
+func TestSchemaForConvertsLikeStructToMap(t *testing.T) {
+	schema, err := SchemaFor[row]("csv")
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+
+	seven := 7
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	var buf bytes.Buffer
+	w := NewWriter(&buf, schema)
+	if err := w.WriteRow(&row{Name: "a", Count: 3, Day: at, At: at, Level: 2, Price: 1.5, Pointer: &seven}); err != nil {
+		t.Fatalf("WriteRow: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := "name,count,day,at,level,price,pointer\na,3,2024-01-02," + at.String() + ",**,1.5,7\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestSchemaForReturnsConversionErrors(t *testing.T) {
+	type withHook struct {
+		Value failing `csv:"value"`
+	}
+
+	schema, err := SchemaFor[withHook]("csv")
+	if err != nil {
+		t.Fatalf("SchemaFor: %v", err)
+	}
+
+	w := NewWriter(&bytes.Buffer{}, schema)
+	if err := w.WriteRow(&withHook{}); !errors.Is(err, errMarshal) {
+		t.Fatalf("WriteRow: got %v, want %v", err, errMarshal)
+	}
+}
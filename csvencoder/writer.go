@@ -0,0 +1,272 @@
+package csvencoder
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Quoting selects which fields a Writer encloses in double quotes.
+type Quoting int
+
+const (
+	// QuoteMinimal quotes fields containing the separator, a double quote or a line break, or starting
+	// with a space, like encoding/csv.
+	QuoteMinimal Quoting = iota
+	// QuoteAll quotes every field, the header included.
+	QuoteAll
+	// QuoteNonNumeric quotes every field that is not rendered from an integer or a float.
+	QuoteNonNumeric
+	// QuoteNever writes fields verbatim; the caller guarantees they need no quoting.
+	QuoteNever
+)
+
+// FloatFormat selects how float columns are rendered, as by strconv.FormatFloat with Format 'f', 'e',
+// 'E', 'g' or 'G' and Precision digits. The zero value renders the shortest exact decimal without exponent.
+type FloatFormat struct {
+	Format    byte
+	Precision int
+}
+
+// Writer encodes rows of type T as CSV following a Schema, without reflection.
+// It buffers its output; call Flush once done.
+type Writer[T any] struct {
+	w              *bufio.Writer
+	schema         Schema[T]
+	separator      rune
+	header         bool
+	floatFormat    FloatFormat
+	locale         Locale
+	quoting        Quoting
+	lineTerminator string
+
+	started bool
+	buf     []byte
+	num     []byte
+}
+
+// NewWriter returns a Writer separating fields with ',', writing a header row and terminating lines with "\n".
+func NewWriter[T any](w io.Writer, schema Schema[T]) *Writer[T] {
+	return &Writer[T]{
+		w:              bufio.NewWriter(w),
+		schema:         schema,
+		separator:      ',',
+		header:         true,
+		lineTerminator: "\n",
+	}
+}
+
+func (w *Writer[T]) WithSeparator(separator rune) *Writer[T] {
+	w.separator = separator
+	return w
+}
+
+// WithHeader sets whether the first WriteRow call writes the header row first.
+func (w *Writer[T]) WithHeader(header bool) *Writer[T] {
+	w.header = header
+	return w
+}
+
+func (w *Writer[T]) WithFloatFormat(floatFormat FloatFormat) *Writer[T] {
+	w.floatFormat = floatFormat
+	return w
+}
+
+// WithLocale sets the decimal and thousands separators of float columns; integer columns, such as
+// Unix timestamps, are never grouped.
+func (w *Writer[T]) WithLocale(locale Locale) *Writer[T] {
+	w.locale = locale
+	return w
+}
+
+func (w *Writer[T]) WithQuoting(quoting Quoting) *Writer[T] {
+	w.quoting = quoting
+	return w
+}
+
+func (w *Writer[T]) WithLineTerminator(lineTerminator string) *Writer[T] {
+	w.lineTerminator = lineTerminator
+	return w
+}
+
+// WriteHeader writes the header row. WriteRow calls it on its first call unless disabled with WithHeader.
+func (w *Writer[T]) WriteHeader() error {
+	w.started = true
+
+	w.buf = w.buf[:0]
+	for i, c := range w.schema {
+		if i > 0 {
+			w.buf = utf8.AppendRune(w.buf, w.separator)
+		}
+		w.buf = w.appendField(w.buf, c.Header, false)
+	}
+
+	return w.writeLine()
+}
+
+func (w *Writer[T]) WriteRow(row T) error {
+	if !w.started {
+		if err := w.validate(); err != nil {
+			return err
+		}
+
+		if w.header {
+			if err := w.WriteHeader(); err != nil {
+				return err
+			}
+		}
+		w.started = true
+	}
+
+	w.buf = w.buf[:0]
+	for i, c := range w.schema {
+		if i > 0 {
+			w.buf = utf8.AppendRune(w.buf, w.separator)
+		}
+		var err error
+		w.buf, err = w.appendColumn(w.buf, c, row)
+		if err != nil {
+			return fmt.Errorf("failed to encode column %s: %w", c.Header, err)
+		}
+	}
+
+	return w.writeLine()
+}
+
+// Flush writes any buffered data to the underlying writer.
+func (w *Writer[T]) Flush() error {
+	return w.w.Flush()
+}
+
+// Buffered returns the number of bytes written to the Writer but not yet flushed.
+func (w *Writer[T]) Buffered() int {
+	return w.w.Buffered()
+}
+
+func (w *Writer[T]) validate() error {
+	if w.separator == '"' || w.separator == '\r' || w.separator == '\n' || !utf8.ValidRune(w.separator) {
+		return fmt.Errorf("invalid separator %q", w.separator)
+	}
+
+	switch w.floatFormat.Format {
+	case 0, 'f', 'e', 'E', 'g', 'G':
+	default:
+		return fmt.Errorf("invalid float format %q", w.floatFormat.Format)
+	}
+
+	if err := w.locale.validate(w.separator); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (w *Writer[T]) writeLine() error {
+	w.buf = append(w.buf, w.lineTerminator...)
+	_, err := w.w.Write(w.buf)
+	return err
+}
+
+func (w *Writer[T]) appendColumn(dst []byte, c Column[T], row T) ([]byte, error) {
+	switch {
+	case c.str != nil:
+		return w.appendField(dst, c.str(row), false), nil
+	case c.integer != nil:
+		return w.appendNumber(dst, strconv.AppendInt(w.num[:0], c.integer(row), 10)), nil
+	case c.float != nil:
+		return w.appendNumber(dst, w.appendFloat(w.num[:0], c.float(row))), nil
+	}
+
+	var value interface{}
+	if c.convert != nil {
+		var err error
+		value, err = c.convert(row)
+		if err != nil {
+			return dst, err
+		}
+	} else {
+		value = c.value(row)
+	}
+
+	switch v := value.(type) {
+	case int64:
+		return w.appendNumber(dst, strconv.AppendInt(w.num[:0], v, 10)), nil
+	case int:
+		return w.appendNumber(dst, strconv.AppendInt(w.num[:0], int64(v), 10)), nil
+	case float64:
+		return w.appendNumber(dst, w.appendFloat(w.num[:0], v)), nil
+	case string:
+		return w.appendField(dst, v, false), nil
+	default:
+		return w.appendField(dst, fmt.Sprintf("%v", v), false), nil
+	}
+}
+
+// appendFloat appends v rendered with the float format and locale of the writer.
+func (w *Writer[T]) appendFloat(dst []byte, v float64) []byte {
+	var number [64]byte
+	if w.floatFormat.Format == 0 {
+		return w.locale.localize(dst, strconv.AppendFloat(number[:0], v, 'f', -1, 64))
+	}
+
+	return w.locale.localize(dst, strconv.AppendFloat(number[:0], v, w.floatFormat.Format, w.floatFormat.Precision, 64))
+}
+
+func (w *Writer[T]) appendNumber(dst []byte, number []byte) []byte {
+	w.num = number
+	if w.quoting == QuoteAll {
+		dst = append(dst, '"')
+		dst = append(dst, number...)
+		return append(dst, '"')
+	}
+
+	return append(dst, number...)
+}
+
+func (w *Writer[T]) appendField(dst []byte, field string, numeric bool) []byte {
+	quote := false
+	switch w.quoting {
+	case QuoteAll:
+		quote = true
+	case QuoteNonNumeric:
+		quote = !numeric
+	case QuoteMinimal:
+		quote = w.fieldNeedsQuotes(field)
+	}
+
+	if !quote {
+		return append(dst, field...)
+	}
+
+	dst = append(dst, '"')
+	for i := 0; i < len(field); i++ {
+		if field[i] == '"' {
+			dst = append(dst, '"')
+		}
+		dst = append(dst, field[i])
+	}
+
+	return append(dst, '"')
+}
+
+func (w *Writer[T]) fieldNeedsQuotes(field string) bool {
+	if field == "" {
+		return false
+	}
+
+	if field == `\.` {
+		return true
+	}
+
+	for _, r := range field {
+		if r == w.separator || r == '"' || r == '\r' || r == '\n' {
+			return true
+		}
+	}
+
+	r, _ := utf8.DecodeRuneInString(field)
+	return unicode.IsSpace(r)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"github.com/condrove10/dukascopy-downloader/tick"
+	"iter"
+	"sync"
 )
 
 var (
@@ -12,13 +14,22 @@ var (
 )
 
 // Cursor manages data and error channels, mimicking a cursor's behavior.
+//
+// The producer sends every data point on the data channel and closes it once done; closing
+// the data channel is the single completion signal. The terminal error, if any, is then sent
+// on the error channel, which the producer closes afterwards.
+//
+// A Cursor delivers every produced data point exactly once, in the order it was sent,
+// and only reports exhaustion after the data channel was drained.
 type Cursor struct {
-	dataCh       <-chan *tick.Tick
-	errCh        <-chan error
-	current      *tick.Tick
-	closed       bool
-	error        error
-	bufferLength uint64
+	dataCh    <-chan *tick.Tick
+	errCh     <-chan error
+	current   *tick.Tick
+	exhausted bool
+	error     error
+	closer    func()
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
 // NewCursor initializes a new Cursor with data and error channels.
@@ -26,58 +37,180 @@ func NewCursor(dataCh <-chan *tick.Tick, errCh <-chan error) *Cursor {
 	return &Cursor{
 		dataCh: dataCh,
 		errCh:  errCh,
+		done:   make(chan struct{}),
 	}
 }
 
+// WithCloser sets the function Close uses to stop the producers feeding the cursor.
+// The closer must return only once every producer has exited.
+func (c *Cursor) WithCloser(closer func()) *Cursor {
+	c.closer = closer
+	return c
+}
+
+// Close stops the producers and abandons any buffered data.
+// It blocks until the producers have exited and is safe to call repeatedly
+// or concurrently with Next; subsequent calls to Next return false.
+func (c *Cursor) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if c.closer != nil {
+			c.closer()
+		}
+	})
+
+	return nil
+}
+
 // Next advances the cursor to the next data point.
-// It returns true if there is a next data point, and false if the cursor is exhausted or an error occurred.
+// It returns true if there is a next data point, and false if the cursor is exhausted, closed,
+// ctx was cancelled or the producer failed; Error reports the reason in the last two cases.
 func (c *Cursor) Next(ctx context.Context) bool {
-	if c.closed {
-		if c.bufferLength > 0 {
-			c.current = <-c.dataCh
-			c.bufferLength--
-			return true
-		}
+	c.current = nil
 
+	if c.exhausted || c.isClosed() {
 		return false
 	}
 
 	select {
+	case <-c.done:
+		return false
+
 	case <-ctx.Done():
 		c.error = ctx.Err()
-		c.closed = true
+		c.exhausted = true
 		return false
 
-	case err, ok := <-c.errCh:
+	case data, ok := <-c.dataCh:
 		if !ok {
-			c.bufferLength = uint64(len(c.dataCh))
-			c.closed = true
-			return true
-		}
-
-		if err != nil {
-			c.error = err
-			c.closed = true
+			c.exhausted = true
+			c.error = c.terminalError(ctx)
 			return false
 		}
-		return true
 
-	case data, ok := <-c.dataCh:
-		if !ok {
-			c.bufferLength = uint64(len(c.dataCh))
-			c.closed = true
-			return true
-		}
 		c.current = data
 		return true
 	}
 }
 
+// terminalError waits for the producer to report how it ended once the data channel was closed.
+func (c *Cursor) terminalError(ctx context.Context) error {
+	select {
+	case err := <-c.errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return nil
+	}
+}
+
+func (c *Cursor) isClosed() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
 // Read returns the current data point.
-func (c *Cursor) Read() *tick.Tick {
-	return c.current
+// It returns ErrNoCurrentData before the first call to Next or once Next returned false,
+// and ErrCursorClosed after Close.
+func (c *Cursor) Read() (*tick.Tick, error) {
+	if c.isClosed() {
+		return nil, ErrCursorClosed
+	}
+
+	if c.current == nil {
+		return nil, ErrNoCurrentData
+	}
+
+	return c.current, nil
 }
 
+// Error returns the terminal error of the producer or the context error that stopped Next.
+// It returns nil while the cursor is not exhausted and when the producer completed successfully.
 func (c *Cursor) Error() error {
 	return c.error
 }
+
+// All returns an iterator over the remaining data points. The cursor is closed when the
+// iteration ends; a terminal error, including cancellation of ctx, is yielded as the last element.
+func (c *Cursor) All(ctx context.Context) iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		defer c.Close()
+
+		for c.Next(ctx) {
+			t, err := c.Read()
+			if !yield(t, err) || err != nil {
+				return
+			}
+		}
+
+		if err := c.Error(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+// FromSeq returns a Cursor over the ticks yielded by seq. seq runs in its own goroutine, at most
+// bufferSize ticks ahead of the consumer, until it is exhausted, yields an error or the cursor is closed.
+func FromSeq(seq iter.Seq2[*tick.Tick, error], bufferSize int) *Cursor {
+	dataCh := make(chan *tick.Tick, bufferSize)
+	errCh := make(chan error, 1)
+	stop := make(chan struct{})
+	exited := make(chan struct{})
+
+	go func() {
+		defer close(exited)
+		defer close(errCh)
+
+		var err error
+		for t, e := range seq {
+			if e != nil {
+				err = e
+				break
+			}
+
+			select {
+			case dataCh <- t:
+			case <-stop:
+				close(dataCh)
+				return
+			}
+		}
+
+		close(dataCh)
+		if err != nil {
+			errCh <- err
+		}
+	}()
+
+	return NewCursor(dataCh, errCh).WithCloser(func() {
+		close(stop)
+		<-exited
+	})
+}
+
+// FromSeqContext is FromSeq for a sequence reading from a context: seq is called with a context derived
+// from ctx, which Close cancels before waiting for seq to exit, so blocking work inside seq is abandoned.
+func FromSeqContext(ctx context.Context, seq func(ctx context.Context) iter.Seq2[*tick.Tick, error], bufferSize int) *Cursor {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c := FromSeq(func(yield func(*tick.Tick, error) bool) {
+		defer cancel()
+
+		for t, err := range seq(ctx) {
+			if !yield(t, err) {
+				return
+			}
+		}
+	}, bufferSize)
+
+	closer := c.closer
+	return c.WithCloser(func() {
+		cancel()
+		closer()
+	})
+}
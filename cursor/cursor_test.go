@@ -0,0 +1,204 @@
+package cursor
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/condrove10/dukascopy-downloader/tick"
+)
+
+var errProducer = errors.New("producer failed")
+
+func ticks(n int) []*tick.Tick {
+	ts := make([]*tick.Tick, n)
+	for i := range ts {
+		ts[i] = tick.New().WithTimestamp(int64(i))
+	}
+
+	return ts
+}
+
+// drain reads the cursor until Next returns false, failing on any Read error.
+func drain(t *testing.T, c *Cursor) []*tick.Tick {
+	t.Helper()
+
+	var got []*tick.Tick
+	for c.Next(context.Background()) {
+		tk, err := c.Read()
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		got = append(got, tk)
+	}
+
+	return got
+}
+
+func assertSequence(t *testing.T, got []*tick.Tick, n int) {
+	t.Helper()
+
+	if len(got) != n {
+		t.Fatalf("got %d ticks, want %d", len(got), n)
+	}
+	for i, tk := range got {
+		if tk.Timestamp != int64(i) {
+			t.Fatalf("tick %d has timestamp %d", i, tk.Timestamp)
+		}
+	}
+}
+
+func TestCursorExactlyOnce(t *testing.T) {
+	dataCh := make(chan *tick.Tick)
+	errCh := make(chan error)
+	go func() {
+		for _, tk := range ticks(1000) {
+			dataCh <- tk
+		}
+		close(dataCh)
+		close(errCh)
+	}()
+
+	c := NewCursor(dataCh, errCh)
+	if _, err := c.Read(); !errors.Is(err, ErrNoCurrentData) {
+		t.Fatalf("Read before Next: got %v, want ErrNoCurrentData", err)
+	}
+	if err := c.Error(); err != nil {
+		t.Fatalf("Error before exhaustion: %v", err)
+	}
+
+	assertSequence(t, drain(t, c), 1000)
+
+	if err := c.Error(); err != nil {
+		t.Fatalf("Error: %v", err)
+	}
+	if _, err := c.Read(); !errors.Is(err, ErrNoCurrentData) {
+		t.Fatalf("Read after exhaustion: got %v, want ErrNoCurrentData", err)
+	}
+	if c.Next(context.Background()) {
+		t.Fatal("Next returned true after exhaustion")
+	}
+}
+
+func TestCursorErrorSentBeforeData(t *testing.T) {
+	// The error is ready before any data is read; the buffered data must still come first.
+	dataCh := make(chan *tick.Tick, 10)
+	errCh := make(chan error, 1)
+	errCh <- errProducer
+	close(errCh)
+	for _, tk := range ticks(10) {
+		dataCh <- tk
+	}
+	close(dataCh)
+
+	c := NewCursor(dataCh, errCh)
+	assertSequence(t, drain(t, c), 10)
+
+	if err := c.Error(); !errors.Is(err, errProducer) {
+		t.Fatalf("Error: got %v, want %v", err, errProducer)
+	}
+}
+
+func TestCursorProducerErrorAfterData(t *testing.T) {
+	seq := func(yield func(*tick.Tick, error) bool) {
+		for _, tk := range ticks(5) {
+			if !yield(tk, nil) {
+				return
+			}
+		}
+		yield(nil, errProducer)
+	}
+
+	c := FromSeq(seq, 2)
+	defer c.Close()
+
+	assertSequence(t, drain(t, c), 5)
+
+	if err := c.Error(); !errors.Is(err, errProducer) {
+		t.Fatalf("Error: got %v, want %v", err, errProducer)
+	}
+	if _, err := c.Read(); !errors.Is(err, ErrNoCurrentData) {
+		t.Fatalf("Read after error: got %v, want ErrNoCurrentData", err)
+	}
+}
+
+func TestCursorCloseConcurrentWithNext(t *testing.T) {
+	// An endless producer, which only Close stops.
+	var seq iter.Seq2[*tick.Tick, error] = func(yield func(*tick.Tick, error) bool) {
+		for i := int64(0); ; i++ {
+			if !yield(tick.New().WithTimestamp(i), nil) {
+				return
+			}
+		}
+	}
+
+	c := FromSeq(seq, 4)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	var read int64
+	go func() {
+		defer wg.Done()
+		for c.Next(context.Background()) {
+			tk, err := c.Read()
+			if err != nil {
+				// Close raced with Next.
+				if !errors.Is(err, ErrCursorClosed) {
+					t.Errorf("Read: %v", err)
+				}
+				return
+			}
+			if tk.Timestamp != read {
+				t.Errorf("got timestamp %d, want %d", tk.Timestamp, read)
+				return
+			}
+			read++
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.Close()
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next or Close did not return after Close")
+	}
+
+	if c.Next(context.Background()) {
+		t.Fatal("Next returned true after Close")
+	}
+	if _, err := c.Read(); !errors.Is(err, ErrCursorClosed) {
+		t.Fatalf("Read after Close: got %v, want ErrCursorClosed", err)
+	}
+}
+
+func TestCursorContextCancelled(t *testing.T) {
+	c := NewCursor(make(chan *tick.Tick), make(chan error))
+	defer c.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if c.Next(ctx) {
+		t.Fatal("Next returned true with a cancelled context")
+	}
+	if err := c.Error(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Error: got %v, want context.Canceled", err)
+	}
+}
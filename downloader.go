@@ -1,37 +1,83 @@
 package downloader
 
 import (
-	"compress/gzip"
 	"context"
 	"fmt"
-	"github.com/condrove10/dukascopy-downloader/conversions"
-	"github.com/condrove10/dukascopy-downloader/csvencoder"
+	"github.com/condrove10/dukascopy-downloader/candle"
 	"github.com/condrove10/dukascopy-downloader/cursor"
 	"github.com/condrove10/dukascopy-downloader/internal/parser"
 	"github.com/condrove10/dukascopy-downloader/internal/timeformat"
 	"github.com/condrove10/dukascopy-downloader/retryablehttp"
+	"github.com/condrove10/dukascopy-downloader/sink"
+	"github.com/condrove10/dukascopy-downloader/stream"
 	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
 	"github.com/go-playground/validator/v10"
-	"io"
+	"iter"
 	"net/http"
-	"os"
-	"sync"
+	"runtime"
 	"time"
 )
 
 const urlTemplate = "https://datafeed.dukascopy.com/datafeed/%s/%04d/%02d/%02d/%02dh_ticks.bi5"
 
+// DefaultHeaders are the request headers used when a Downloader has none configured.
+var DefaultHeaders = map[string]string{
+	"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
+	"Accept":          "/",
+	"Accept-Encoding": "gzip, deflate",
+	"Origin":          "https://freeserv.dukascopy.com",
+	"Connection":      "keep-alive",
+	"Referer":         "https://freeserv.dukascopy.com/",
+	"Cache-Control":   "no-cache",
+}
+
+// Downloader fetches the ticks of Symbol in the half-open range [StartTime, EndTime).
 type Downloader struct {
-	Symbol      string       `validate:"required,min=3"`
-	StartTime   time.Time    `validate:"required"`
-	EndTime     time.Time    `validate:"required"`
-	Concurrency int          `validate:"required,gt=0"`
-	HttpClient  *http.Client `validate:"required"`
+	Symbol string `validate:"required,min=3"`
+	// StartTime is the first instant included in the download.
+	StartTime time.Time `validate:"required"`
+	// EndTime is the first instant excluded from the download.
+	EndTime     time.Time `validate:"required"`
+	Concurrency int       `validate:"required,gt=0"`
+	// DecodeConcurrency is the number of LZMA decode workers; zero uses one per CPU.
+	DecodeConcurrency int `validate:"gte=0"`
+	// QueueSize is the number of hours buffered between pipeline stages; zero uses DecodeConcurrency.
+	QueueSize  int          `validate:"gte=0"`
+	HttpClient *http.Client `validate:"required"`
+	// Headers are sent with every request; nil uses DefaultHeaders.
+	Headers map[string]string
+	// Middleware wraps the round trip of every request, first one outermost.
+	Middleware []retryablehttp.Middleware
+	// AttemptTimeout bounds every request attempt, body included; zero leaves attempts unbounded.
+	AttemptTimeout time.Duration `validate:"gte=0"`
+	// Hedger, when set, launches a duplicate request for hours slower than its latency percentile.
+	Hedger *retryablehttp.Hedger
+	// CircuitBreaker, when set, guards every request to the datafeed.
+	CircuitBreaker *retryablehttp.CircuitBreaker
+	// PauseWhileOpen makes the download wait for an open CircuitBreaker instead of failing.
+	PauseWhileOpen bool
+	// BandwidthLimit caps the bytes per second read from response bodies across all fetchers; zero is unlimited.
+	BandwidthLimit int64 `validate:"gte=0"`
+	// BandwidthLimiter enforces the bandwidth limit and is shared by every download of the Downloader and of
+	// its copies, so concurrent runs stay under one budget. WithBandwidthLimit creates it; when it is nil,
+	// every download limits itself to BandwidthLimit on its own.
+	BandwidthLimiter *retryablehttp.BandwidthLimiter
+	// Location is the output timezone: exported timestamps are rendered as RFC3339 in it and candle
+	// boundaries follow its wall clock. Nil keeps Unix nanosecond timestamps and UTC boundaries.
+	Location *time.Location
+	// Clock provides the current time; nil uses the system clock.
+	Clock Clock
+	// OnEvent, when set, receives retry and circuit breaker events; it may be called concurrently.
+	OnEvent func(Event)
+	Metrics *Metrics
 }
 
 var DefaultDownloader = &Downloader{
-	Concurrency: 1,
-	HttpClient:  http.DefaultClient,
+	Concurrency:       1,
+	DecodeConcurrency: runtime.NumCPU(),
+	HttpClient:        http.DefaultClient,
+	AttemptTimeout:    time.Minute,
 }
 
 func (d *Downloader) WithSymbol(symbol string) *Downloader {
@@ -54,209 +100,371 @@ func (d *Downloader) WithConcurrency(concurrency int) *Downloader {
 	return d
 }
 
+func (d *Downloader) WithDecodeConcurrency(decodeConcurrency int) *Downloader {
+	d.DecodeConcurrency = decodeConcurrency
+	return d
+}
+
+func (d *Downloader) WithQueueSize(queueSize int) *Downloader {
+	d.QueueSize = queueSize
+	return d
+}
+
+func (d *Downloader) WithHeaders(headers map[string]string) *Downloader {
+	d.Headers = headers
+	return d
+}
+
+func (d *Downloader) WithMiddleware(middleware ...retryablehttp.Middleware) *Downloader {
+	d.Middleware = middleware
+	return d
+}
+
+func (d *Downloader) WithAttemptTimeout(attemptTimeout time.Duration) *Downloader {
+	d.AttemptTimeout = attemptTimeout
+	return d
+}
+
+func (d *Downloader) WithHedger(hedger *retryablehttp.Hedger) *Downloader {
+	d.Hedger = hedger
+	return d
+}
+
+func (d *Downloader) WithCircuitBreaker(circuitBreaker *retryablehttp.CircuitBreaker) *Downloader {
+	d.CircuitBreaker = circuitBreaker
+	return d
+}
+
+func (d *Downloader) WithPauseWhileOpen(pauseWhileOpen bool) *Downloader {
+	d.PauseWhileOpen = pauseWhileOpen
+	return d
+}
+
+// WithBandwidthLimit sets BandwidthLimit and replaces BandwidthLimiter with a limiter of that rate.
+func (d *Downloader) WithBandwidthLimit(bytesPerSecond int64) *Downloader {
+	d.BandwidthLimit = bytesPerSecond
+	d.BandwidthLimiter = nil
+	if bytesPerSecond > 0 {
+		d.BandwidthLimiter = retryablehttp.NewBandwidthLimiter(bytesPerSecond)
+	}
+	return d
+}
+
+// WithBandwidthLimiter shares limiter with other downloaders, e.g. one per symbol, instead of BandwidthLimit.
+func (d *Downloader) WithBandwidthLimiter(limiter *retryablehttp.BandwidthLimiter) *Downloader {
+	d.BandwidthLimiter = limiter
+	return d
+}
+
+func (d *Downloader) WithLocation(location *time.Location) *Downloader {
+	d.Location = location
+	return d
+}
+
+func (d *Downloader) WithClock(clock Clock) *Downloader {
+	d.Clock = clock
+	return d
+}
+
+func (d *Downloader) WithOnEvent(onEvent func(Event)) *Downloader {
+	d.OnEvent = onEvent
+	return d
+}
+
+func (d *Downloader) WithMetrics(metrics *Metrics) *Downloader {
+	d.Metrics = metrics
+	return d
+}
+
 func (d *Downloader) WithHttpClient(httpClient *http.Client) *Downloader {
 	d.HttpClient = httpClient
 	return d
 }
 
 func (d *Downloader) Download() ([]*tick.Tick, error) {
+	ticks, _, err := d.download(d.Metrics)
+	return ticks, err
+}
+
+// DownloadWithStats downloads like Download and also returns the transfer statistics of this call.
+func (d *Downloader) DownloadWithStats() ([]*tick.Tick, Stats, error) {
+	return d.download(NewMetrics())
+}
+
+func (d *Downloader) download(metrics *Metrics) ([]*tick.Tick, Stats, error) {
 	// Use context background to allow data to be flushed from the channels regardless
 	ctx := context.Background()
 	ticks := []*tick.Tick{}
 
-	c, err := d.Stream(1)
+	c, metrics, err := d.stream(1, metrics)
 	if err != nil {
-		return nil, fmt.Errorf("failed to intialize stream: %w", err)
+		return nil, Stats{}, fmt.Errorf("failed to intialize stream: %w", err)
+	}
+
+	defer c.Close()
+
+	for c.Next(ctx) {
+		t, err := c.Read()
+		if err != nil {
+			return nil, Stats{}, fmt.Errorf("failed to read tick: %w", err)
+		}
+
+		ticks = append(ticks, t)
+	}
+
+	if err := c.Error(); err != nil {
+		return nil, Stats{}, fmt.Errorf("failed to download ticks: %w", err)
 	}
 
-	for {
-		if next := c.Next(ctx); !next {
-			break
+	return ticks, metrics.Stats(), nil
+}
+
+// Ticks returns an iterator over the downloaded ticks. Breaking out of the loop stops the download;
+// a download failure or cancellation of ctx is yielded as the last element.
+func (d *Downloader) Ticks(ctx context.Context) iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		c, err := d.Stream(1)
+		if err != nil {
+			yield(nil, fmt.Errorf("failed to intialize stream: %w", err))
+			return
 		}
 
-		ticks = append(ticks, c.Read())
+		for t, err := range c.All(ctx) {
+			if !yield(t, err) {
+				return
+			}
+		}
+	}
+}
+
+// Batches returns an iterator over the downloaded ticks grouped in slices of up to size ticks.
+func (d *Downloader) Batches(ctx context.Context, size int) iter.Seq2[[]*tick.Tick, error] {
+	return stream.Batch(d.Ticks(ctx), size)
+}
+
+// Candles returns an iterator over candles of the given period built from the downloaded ticks.
+func (d *Downloader) Candles(ctx context.Context, period time.Duration, side candle.Side) iter.Seq2[*candle.Candle, error] {
+	loc := d.Location
+	if loc == nil {
+		loc = time.UTC
 	}
 
-	return ticks, nil
+	return candle.AggregateIn(d.Ticks(ctx), period, side, loc)
 }
 
 func (d *Downloader) Stream(bufferSize int) (*cursor.Cursor, error) {
+	c, _, err := d.stream(bufferSize, d.Metrics)
+	return c, err
+}
+
+// stream starts the download pipeline recording into metrics, or into a new Metrics instance if nil, and returns it.
+func (d *Downloader) stream(bufferSize int, metrics *Metrics) (*cursor.Cursor, *Metrics, error) {
 	streamChan := make(chan *tick.Tick, bufferSize)
 	errorChan := make(chan error, 1)
-	if err := validator.New().Struct(d); err != nil {
-		return nil, fmt.Errorf("failed to validate downloader instance: %w", err)
+	if err := d.validate(); err != nil {
+		return nil, nil, err
 	}
 
-	if d.EndTime.Before(d.StartTime) {
-		return nil, fmt.Errorf("end time must be after start time")
+	if metrics == nil {
+		metrics = NewMetrics()
 	}
 
-	dates := timeformat.GetDateTimeRange(d.StartTime, d.EndTime, 1)
-	concurrencyChan := make(chan struct{}, d.Concurrency)
-	var wg sync.WaitGroup
+	dates := d.hours()
+	p := newPipeline(d, metrics)
 
-	runConcurrentTask(func() error {
-		for _, date := range dates {
-			wg.Add(1)
+	done := runConcurrentTask(func() error {
+		defer close(streamChan)
 
-			runControlledTask(func() error {
-				defer wg.Done()
+		return p.run(dates, streamChan)
+	}, errorChan)
 
-				batch, err := d.fetchTicksForDate(date)
-				if err != nil {
-					return fmt.Errorf("failed to fetch ticks for date %s: %w", date, err)
-				}
+	return cursor.NewCursor(streamChan, errorChan).WithCloser(func() {
+		p.cancel()
+		<-done
+	}), metrics, nil
+}
 
-				for _, t := range batch {
-					streamChan <- t
-				}
+func (d *Downloader) validate() error {
+	if err := validator.New().Struct(d); err != nil {
+		return fmt.Errorf("failed to validate downloader instance: %w", err)
+	}
 
-				return nil
-			}, concurrencyChan, errorChan)
-		}
+	if d.EndTime.Before(d.StartTime) {
+		return fmt.Errorf("end time must be after start time")
+	}
 
-		wg.Wait()
+	return nil
+}
 
-		close(streamChan)
+func (d *Downloader) ToCsv(filePath string) error {
+	_, err := d.toCsv(filePath, d.Metrics)
+	return err
+}
 
-		return nil
-	}, errorChan)
+// ToCsvWithStats writes the ticks like ToCsv and also returns the transfer statistics of this call.
+func (d *Downloader) ToCsvWithStats(filePath string) (Stats, error) {
+	return d.toCsv(filePath, NewMetrics())
+}
 
-	return cursor.NewCursor(streamChan, errorChan), nil
+func (d *Downloader) toCsv(filePath string, metrics *Metrics) (Stats, error) {
+	return d.toFile(filePath, metrics, func() (sink.Sink, error) {
+		return sink.CreateCSV(filePath, sink.CSVOptions{Separator: ';', Timestamp: timestamp.DefaultFormat(d.Location)})
+	})
 }
 
-func (d *Downloader) ToCsv(filePath string) error {
-	ce := csvencoder.NewCSVEncoder()
-	ce.SetSeparator(';')
+func (d *Downloader) ToJsonl(filePath string) error {
+	_, err := d.toJsonl(filePath, d.Metrics)
+	return err
+}
 
-	ticksSlice, err := d.Download()
+// ToJsonlWithStats writes the ticks like ToJsonl and also returns the transfer statistics of this call.
+func (d *Downloader) ToJsonlWithStats(filePath string) (Stats, error) {
+	return d.toJsonl(filePath, NewMetrics())
+}
+
+// toJsonl writes one JSON object per tick and line, keyed by the json tags of tick.Tick.
+func (d *Downloader) toJsonl(filePath string, metrics *Metrics) (Stats, error) {
+	return d.toFile(filePath, metrics, func() (sink.Sink, error) {
+		return sink.CreateJSONL(filePath, sink.JSONLOptions{Timestamp: timestamp.DefaultFormat(d.Location)})
+	})
+}
+
+// toFile streams the ticks into the file sink returned by create. The file is only replaced
+// once the download succeeded; a failed download leaves it untouched.
+func (d *Downloader) toFile(filePath string, metrics *Metrics, create func() (sink.Sink, error)) (Stats, error) {
+	s, err := create()
 	if err != nil {
-		return fmt.Errorf("failed to download ticks: %w", err)
+		return Stats{}, err
 	}
 
-	ticksMapSpice := []map[string]interface{}{}
-	for _, t := range ticksSlice {
-		ticksMap, err := conversions.StructToMap(t, "csv")
-		if err != nil {
-			return fmt.Errorf("failed to convert ticks: %w", err)
-		}
+	stats, err := d.toSink(s, metrics)
+	if err != nil {
+		sink.Abort(s)
+		return Stats{}, err
+	}
 
-		ticksMapSpice = append(ticksMapSpice, ticksMap)
+	if err := s.Close(); err != nil {
+		return Stats{}, fmt.Errorf("failed to write file %s: %w", filePath, err)
 	}
 
-	f, err := os.Create(filePath)
+	return stats, nil
+}
+
+// ToSink streams the downloaded ticks into s as they arrive and returns the transfer statistics of
+// this call. The caller keeps ownership of s: it must close it, or discard it with sink.Abort on failure.
+func (d *Downloader) ToSink(s sink.Sink) (Stats, error) {
+	return d.toSink(s, NewMetrics())
+}
+
+func (d *Downloader) toSink(s sink.Sink, metrics *Metrics) (Stats, error) {
+	c, metrics, err := d.stream(1, metrics)
 	if err != nil {
-		return fmt.Errorf("failed to open file %s: %w", filePath, err)
+		return Stats{}, fmt.Errorf("failed to intialize stream: %w", err)
 	}
 
-	defer f.Close()
+	defer c.Close()
 
-	if err := ce.Encode(f, ticksMapSpice); err != nil {
-		return fmt.Errorf("failed to encode csv: %w", err)
+	for c.Next(context.Background()) {
+		t, err := c.Read()
+		if err != nil {
+			return Stats{}, fmt.Errorf("failed to read tick: %w", err)
+		}
+
+		if err := s.Write(t); err != nil {
+			return Stats{}, fmt.Errorf("failed to write tick: %w", err)
+		}
 	}
 
-	return nil
+	if err := c.Error(); err != nil {
+		return Stats{}, fmt.Errorf("failed to download ticks: %w", err)
+	}
+
+	return metrics.Stats(), nil
 }
 
-func runConcurrentTask(task func() error, errorChan chan error) {
+// runConcurrentTask runs task in its own goroutine and returns a channel closed once the task
+// has returned and its error, if any, has been delivered to errorChan.
+func runConcurrentTask(task func() error, errorChan chan error) <-chan struct{} {
+	done := make(chan struct{})
+
 	go func() {
+		defer close(done)
+
 		if err := task(); err != nil {
 			errorChan <- err
 		}
 
 		close(errorChan)
 	}()
+
+	return done
 }
 
-func runControlledTask(task func() error, concurrencyChan chan struct{}, errorChan chan error) {
-	concurrencyChan <- struct{}{}
+func (d *Downloader) decodeConcurrency() int {
+	if d.DecodeConcurrency > 0 {
+		return d.DecodeConcurrency
+	}
 
-	go func() {
-		if err := task(); err != nil {
-			errorChan <- err
-		}
-		<-concurrencyChan
-	}()
+	return runtime.NumCPU()
 }
 
-func (d *Downloader) fetch(date time.Time) ([]byte, error) {
-	headers := map[string]string{
-		"User-Agent":      "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:131.0) Gecko/20100101 Firefox/131.0",
-		"Accept":          "/",
-		"Accept-Encoding": "gzip, deflate",
-		"Origin":          "https://freeserv.dukascopy.com",
-		"Connection":      "keep-alive",
-		"Referer":         "https://freeserv.dukascopy.com/",
-		"Cache-Control":   "no-cache",
+func (d *Downloader) queueSize() int {
+	if d.QueueSize > 0 {
+		return d.QueueSize
 	}
 
-	url := fmt.Sprintf(urlTemplate, d.Symbol, date.Year(), date.Month()-1, date.Day(), date.Hour())
+	return d.decodeConcurrency()
+}
 
-	client := retryablehttp.DefaultClient.WithContext(context.Background()).WithUrl(url).WithHttpClient(d.HttpClient).WithMethod(retryablehttp.MethodGet).
-		WithMaxRetries(5).WithRetryDelay(time.Second * 15).WithHeader(headers).WithRetryCondition(func(resp *http.Response, err error) bool {
-		if err != nil || resp.StatusCode != http.StatusOK {
-			return true
-		}
+// newClient returns the retryable client every hour request of a run is derived from.
+func (d *Downloader) newClient(middleware ...retryablehttp.Middleware) *retryablehttp.Client {
+	headers := d.Headers
+	if headers == nil {
+		headers = DefaultHeaders
+	}
 
-		return false
-	})
+	return retryablehttp.DefaultClient.WithHttpClient(d.HttpClient).WithMethod(retryablehttp.MethodGet).
+		WithMaxRetries(5).WithRetryDelay(time.Second * 15).WithHeader(headers).WithBodyValidator(parser.Validate).WithClassifier(retryablehttp.DefaultClassifier).
+		WithAttemptTimeout(d.AttemptTimeout).WithHedger(d.Hedger).WithCircuitBreaker(d.CircuitBreaker).WithMiddleware(d.Middleware...).
+		WithMiddleware(middleware...)
+}
 
-	resp, err := client.Do()
-	if err != nil {
-		return nil, fmt.Errorf("error fetching data for url '%s': %w", url, err)
-	}
-	var reader io.ReadCloser
-	switch resp.Header.Get("Content-Encoding") {
-	case "gzip":
-		reader, err = gzip.NewReader(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("error creating gzip reader: %w", err)
-		}
-		defer reader.Close()
-	default:
-		reader = resp.Body
+// bandwidthLimiter returns the limiter of a download: the shared BandwidthLimiter, or one of its own
+// for BandwidthLimit; nil means unlimited.
+func (d *Downloader) bandwidthLimiter() *retryablehttp.BandwidthLimiter {
+	if d.BandwidthLimiter != nil {
+		return d.BandwidthLimiter
 	}
 
-	content, err := io.ReadAll(reader)
-	if err != nil {
-		return nil, fmt.Errorf("error reading data for url '%s': %w", url, err)
+	if d.BandwidthLimit > 0 {
+		return retryablehttp.NewBandwidthLimiter(d.BandwidthLimit)
 	}
 
-	return content, nil
+	return nil
 }
 
-func (d *Downloader) fetchTicksForDate(date time.Time) ([]*tick.Tick, error) {
-	data, err := d.fetch(date.UTC())
-	if err != nil {
-		return nil, fmt.Errorf("failed to fetch data: %w", err)
-	}
-
-	parsedTicks, err := parser.Decode(data, d.Symbol, date)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse data: %w", err)
-	}
+func (d *Downloader) url(date time.Time) string {
+	return fmt.Sprintf(urlTemplate, d.Symbol, date.Year(), date.Month()-1, date.Day(), date.Hour())
+}
 
-	if time.Date(d.StartTime.Year(), d.StartTime.Month(), d.StartTime.Day(), d.StartTime.Hour(), 0, 0, 0, d.StartTime.Location()).Equal(date) {
-		tmp := []*tick.Tick{}
-		for _, t := range parsedTicks {
-			if time.Unix(0, t.Timestamp).After(d.StartTime) || time.Unix(0, t.Timestamp).Equal(d.StartTime) {
-				tmp = append(tmp, t)
-			}
-		}
+// hours returns the UTC start of every hour overlapping the download range.
+func (d *Downloader) hours() []time.Time {
+	return timeformat.GetDateTimeRange(d.StartTime, d.EndTime, d.now(), timeformat.Hour)
+}
 
-		return tmp, nil
+// filterTicksForDate drops the ticks of a partially requested hour that fall outside [StartTime, EndTime).
+func (d *Downloader) filterTicksForDate(parsedTicks []*tick.Tick, date time.Time) []*tick.Tick {
+	start, end := d.StartTime.UnixNano(), d.EndTime.UnixNano()
+	if date.UnixNano() >= start && date.Add(time.Hour).UnixNano() <= end {
+		return parsedTicks
 	}
 
-	if time.Date(d.EndTime.Year(), d.EndTime.Month(), d.EndTime.Day(), d.EndTime.Hour(), 0, 0, 0, d.EndTime.Location()).Equal(date) {
-		tmp := make([]*tick.Tick, 0)
-		for _, t := range parsedTicks {
-			if time.Unix(0, t.Timestamp).Before(d.EndTime) || time.Unix(0, t.Timestamp).Equal(d.EndTime) {
-				tmp = append(tmp, t)
-			}
+	filtered := make([]*tick.Tick, 0, len(parsedTicks))
+	for _, t := range parsedTicks {
+		if t.Timestamp >= start && t.Timestamp < end {
+			filtered = append(filtered, t)
 		}
-
-		return tmp, nil
 	}
 
-	return parsedTicks, nil
+	return filtered
 }
@@ -0,0 +1,225 @@
+package downloader
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kjk/lzma"
+)
+
+const ticksPerHour = 5
+
+var hourPath = regexp.MustCompile(`/(\d{4})/(\d{2})/(\d{2})/(\d{2})h_ticks\.bi5$`)
+
+// stubTransport serves ticksPerHour ticks for every hour and counts the requests per URL. Later hours
+// are answered sooner, so responses complete out of order.
+type stubTransport struct {
+	mu       sync.Mutex
+	requests map[string]int
+	// truncated is the number of responses per URL whose body is cut short before the complete one.
+	truncated map[string]int
+}
+
+// encodeMu serialises the LZMA encoder, which is not safe for concurrent use.
+var encodeMu sync.Mutex
+
+func (s *stubTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	s.requests[r.URL.String()]++
+	truncate := s.truncated[r.URL.String()] > 0
+	if truncate {
+		s.truncated[r.URL.String()]--
+	}
+	s.mu.Unlock()
+
+	m := hourPath.FindStringSubmatch(r.URL.Path)
+	if m == nil {
+		return &http.Response{StatusCode: http.StatusNotFound, Body: http.NoBody, Header: http.Header{}, Request: r}, nil
+	}
+	hour, _ := strconv.Atoi(m[4])
+	time.Sleep(time.Duration(24-hour) * time.Millisecond)
+
+	var raw bytes.Buffer
+	for i := 0; i < ticksPerHour; i++ {
+		binary.Write(&raw, binary.BigEndian, struct {
+			TimeMs    int32
+			Ask       int32
+			Bid       int32
+			VolumeAsk float32
+			VolumeBid float32
+		}{int32(i * 600000), int32(110000 + hour), int32(109990 + hour), 1.5, 2.5})
+	}
+
+	encodeMu.Lock()
+	defer encodeMu.Unlock()
+
+	var body bytes.Buffer
+	w := lzma.NewWriterSizeLevel(&body, int64(raw.Len()), lzma.BestSpeed)
+	w.Write(raw.Bytes())
+	w.Close()
+
+	if truncate {
+		body.Truncate(body.Len() / 2)
+	}
+
+	return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(&body), Header: http.Header{}, Request: r}, nil
+}
+
+func TestDownloadConcurrent(t *testing.T) {
+	transport := &stubTransport{requests: make(map[string]int)}
+	d := &Downloader{
+		Symbol:      "EURUSD",
+		StartTime:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC),
+		Concurrency: 4,
+		HttpClient:  &http.Client{Transport: transport},
+	}
+
+	ticks, err := d.Download()
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+
+	hours := d.hours()
+	if len(hours) != 24 {
+		t.Fatalf("got %d hours, want 24", len(hours))
+	}
+	for _, hour := range hours {
+		if n := transport.requests[d.url(hour)]; n != 1 {
+			t.Errorf("%s requested %d times, want 1", d.url(hour), n)
+		}
+	}
+	if len(transport.requests) != len(hours) {
+		t.Errorf("got %d distinct requests, want %d", len(transport.requests), len(hours))
+	}
+
+	if len(ticks) != len(hours)*ticksPerHour {
+		t.Fatalf("got %d ticks, want %d", len(ticks), len(hours)*ticksPerHour)
+	}
+	for i, tk := range ticks {
+		hour := hours[i/ticksPerHour]
+		want := hour.Add(time.Duration(i%ticksPerHour) * 10 * time.Minute).UnixNano()
+		if tk.Timestamp != want {
+			t.Fatalf("tick %d at %s, want %s", i, time.Unix(0, tk.Timestamp).UTC(), time.Unix(0, want).UTC())
+		}
+		if tk.Symbol != "EURUSD" {
+			t.Fatalf("tick %d has symbol %q", i, tk.Symbol)
+		}
+	}
+}
+
+func TestBandwidthLimiterShared(t *testing.T) {
+	d := (&Downloader{
+		Symbol:      "EURUSD",
+		StartTime:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2024, 1, 2, 2, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+		HttpClient:  &http.Client{Transport: &stubTransport{requests: make(map[string]int)}},
+	}).WithBandwidthLimit(1 << 20)
+
+	limiter := d.BandwidthLimiter
+	if limiter == nil {
+		t.Fatal("WithBandwidthLimit did not create a limiter")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Download(); err != nil {
+				t.Errorf("Download: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if d.bandwidthLimiter() != limiter {
+		t.Fatal("downloads do not share the limiter")
+	}
+
+	copied := *d
+	if copied.bandwidthLimiter() != limiter {
+		t.Fatal("a copy of the downloader does not share its limiter")
+	}
+
+	if d.WithBandwidthLimit(0).bandwidthLimiter() != nil {
+		t.Fatal("a zero bandwidth limit still has a limiter")
+	}
+}
+
+func TestDownloadRefetchesTruncatedHours(t *testing.T) {
+	d := &Downloader{
+		Symbol:      "EURUSD",
+		StartTime:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2024, 1, 2, 6, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+	}
+	hours := d.hours()
+	transport := &stubTransport{
+		requests:  make(map[string]int),
+		truncated: map[string]int{d.url(hours[1]): 1, d.url(hours[4]): maxDecodeAttempts - 1},
+	}
+	d.HttpClient = &http.Client{Transport: transport}
+
+	var retries atomic.Int64
+	d.OnEvent = func(e Event) {
+		if e.Type == EventRetry {
+			retries.Add(1)
+		}
+	}
+
+	ticks, err := d.Download()
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	if len(ticks) != len(hours)*ticksPerHour {
+		t.Fatalf("got %d ticks, want %d", len(ticks), len(hours)*ticksPerHour)
+	}
+
+	for i, hour := range hours {
+		want := 1
+		switch i {
+		case 1:
+			want = 2
+		case 4:
+			want = maxDecodeAttempts
+		}
+		if n := transport.requests[d.url(hour)]; n != want {
+			t.Errorf("%s requested %d times, want %d", d.url(hour), n, want)
+		}
+	}
+	if n := retries.Load(); n != maxDecodeAttempts {
+		t.Errorf("got %d retry events, want %d", n, maxDecodeAttempts)
+	}
+}
+
+func TestDownloadFailsAfterDecodeAttempts(t *testing.T) {
+	d := &Downloader{
+		Symbol:      "EURUSD",
+		StartTime:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+	}
+	hours := d.hours()
+	transport := &stubTransport{
+		requests:  make(map[string]int),
+		truncated: map[string]int{d.url(hours[2]): maxDecodeAttempts},
+	}
+	d.HttpClient = &http.Client{Transport: transport}
+
+	if _, err := d.Download(); err == nil {
+		t.Fatal("Download succeeded with an hour that never decodes")
+	}
+	if n := transport.requests[d.url(hours[2])]; n != maxDecodeAttempts {
+		t.Errorf("the hour was requested %d times, want %d", n, maxDecodeAttempts)
+	}
+}
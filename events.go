@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"github.com/condrove10/dukascopy-downloader/retryablehttp"
+	"time"
+)
+
+type EventType string
+
+const (
+	// EventRetry is emitted before an hour is requested again after a failed attempt.
+	EventRetry EventType = "retry"
+	// EventCircuitStateChange is emitted when the circuit breaker guarding the datafeed changes state.
+	EventCircuitStateChange EventType = "circuit_state_change"
+)
+
+// Event describes something noteworthy that happened during a download.
+// Only the fields relevant to its Type are set.
+type Event struct {
+	Type EventType
+	Time time.Time
+	// Hour is the hour being fetched, for hour related events.
+	Hour time.Time
+	// Attempt is the number of the failed attempt, for EventRetry.
+	Attempt int
+	// Delay is the wait before the next attempt, for EventRetry.
+	Delay time.Duration
+	// Err is the cause of the failed attempt, for EventRetry.
+	Err error
+	// From and To are the previous and new breaker states, for EventCircuitStateChange.
+	From retryablehttp.CircuitState
+	To   retryablehttp.CircuitState
+}
+
+// emit delivers event to the OnEvent callback, if any. The callback may be called from several goroutines at once.
+func (d *Downloader) emit(event Event) {
+	if d.OnEvent == nil {
+		return
+	}
+
+	event.Time = time.Now()
+	d.OnEvent(event)
+}
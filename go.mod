@@ -5,6 +5,7 @@ go 1.23.0
 require (
 	github.com/go-playground/validator/v10 v10.22.1
 	github.com/kjk/lzma v0.0.0-20161016003348-3fd93898850d
+	github.com/klauspost/compress v1.17.11
 )
 
 require (
@@ -13,7 +13,41 @@ import (
 
 const TickBytes = 20
 
+// lzmaHeaderBytes is the size of the LZMA header: one properties byte, the dictionary size and the uncompressed size.
+const lzmaHeaderBytes = 13
+
+// Validate checks that data is either empty, for an hour without ticks, or starts with a well formed
+// LZMA header whose declared uncompressed size, when known, holds a whole number of ticks. It only
+// inspects the header, so it is cheap enough to run on every attempt; a body that is cut short past
+// the header only fails Decode.
+func Validate(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	if len(data) < lzmaHeaderBytes {
+		return fmt.Errorf("lzma stream too short: %d bytes", len(data))
+	}
+
+	if data[0] >= 9*5*5 {
+		return fmt.Errorf("invalid lzma properties byte: %d", data[0])
+	}
+
+	size := int64(binary.LittleEndian.Uint64(data[5:lzmaHeaderBytes]))
+	if size != -1 && (size < 0 || size%TickBytes != 0) {
+		return fmt.Errorf("invalid uncompressed size: %d", size)
+	}
+
+	return nil
+}
+
+// Decode returns the ticks of an hour payload. A stream holding fewer bytes than its header declares,
+// e.g. a body cut short, is an error.
 func Decode(data []byte, symbol string, date time.Time) ([]*tick.Tick, error) {
+	if len(data) == 0 {
+		return []*tick.Tick{}, nil
+	}
+
 	dec := lzma.NewReader(bytes.NewBuffer(data[:]))
 	defer dec.Close()
 
@@ -21,12 +55,11 @@ func Decode(data []byte, symbol string, date time.Time) ([]*tick.Tick, error) {
 	bytesArr := make([]byte, TickBytes)
 
 	for {
-		n, err := dec.Read(bytesArr[:])
+		n, err := io.ReadFull(dec, bytesArr)
 		if err == io.EOF {
-			err = nil
 			break
 		}
-		if n != TickBytes || err != nil {
+		if err != nil {
 			return nil, fmt.Errorf("decode failed: %d: %v", n, err)
 		}
 
@@ -38,6 +71,13 @@ func Decode(data []byte, symbol string, date time.Time) ([]*tick.Tick, error) {
 		ticksArr = append(ticksArr, t)
 	}
 
+	if len(data) >= lzmaHeaderBytes {
+		size := int64(binary.LittleEndian.Uint64(data[5:lzmaHeaderBytes]))
+		if decoded := int64(len(ticksArr)) * TickBytes; size != -1 && decoded != size {
+			return nil, fmt.Errorf("decode failed: lzma stream holds %d bytes, want %d", decoded, size)
+		}
+	}
+
 	return ticksArr, nil
 }
 
@@ -0,0 +1,96 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/kjk/lzma"
+)
+
+// encode returns the LZMA stream of n ticks, one second apart.
+func encode(t *testing.T, n int) []byte {
+	t.Helper()
+
+	var raw bytes.Buffer
+	for i := 0; i < n; i++ {
+		binary.Write(&raw, binary.BigEndian, struct {
+			TimeMs    int32
+			Ask       int32
+			Bid       int32
+			VolumeAsk float32
+			VolumeBid float32
+		}{int32(i * 1000), 110000, 109990, 1.5, 2.5})
+	}
+
+	var out bytes.Buffer
+	w := lzma.NewWriterSizeLevel(&out, int64(raw.Len()), lzma.BestSpeed)
+	if _, err := w.Write(raw.Bytes()); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	return out.Bytes()
+}
+
+func TestValidate(t *testing.T) {
+	valid := encode(t, 100)
+
+	badSize := bytes.Clone(valid)
+	binary.LittleEndian.PutUint64(badSize[5:13], 21)
+
+	tests := []struct {
+		name  string
+		data  []byte
+		valid bool
+	}{
+		{name: "empty", data: nil, valid: true},
+		{name: "complete", data: valid, valid: true},
+		{name: "short header", data: valid[:8], valid: false},
+		{name: "invalid properties", data: append([]byte{0xff}, valid[1:]...), valid: false},
+		{name: "partial tick size", data: badSize, valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.data)
+			if tt.valid && err != nil {
+				t.Fatalf("Validate: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("Validate accepted an invalid payload")
+			}
+		})
+	}
+}
+
+func TestDecodeRejectsTruncatedPayloads(t *testing.T) {
+	valid := encode(t, 100)
+	hour := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	for _, data := range [][]byte{valid[:len(valid)/2], valid[:len(valid)-1], append(bytes.Clone(valid[:13]), bytes.Repeat([]byte{0xff}, 64)...)} {
+		if _, err := Decode(data, "EURUSD", hour); err == nil {
+			t.Errorf("Decode accepted a payload cut to %d of %d bytes", len(data), len(valid))
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	hour := time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC)
+
+	ticks, err := Decode(encode(t, 3), "EURUSD", hour)
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(ticks) != 3 {
+		t.Fatalf("got %d ticks, want 3", len(ticks))
+	}
+	for i, tk := range ticks {
+		if want := hour.Add(time.Duration(i) * time.Second).UnixNano(); tk.Timestamp != want {
+			t.Errorf("tick %d at %d, want %d", i, tk.Timestamp, want)
+		}
+	}
+}
@@ -4,22 +4,59 @@ import (
 	"time"
 )
 
-func GetDateTimeRange(start, end time.Time, hourInterval int) []time.Time {
-	now := time.Now()
+// Granularity is the length of the periods a range is split into.
+type Granularity int
 
-	currentHour := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location())
-	if currentHour.Equal(time.Date(end.Year(), end.Month(), end.Day(), end.Hour(), 0, 0, 0, end.Location())) {
-		end = time.Date(end.Year(), end.Month(), end.Day(), end.Hour()-1, 0, 0, 0, end.Location())
+const (
+	Hour Granularity = iota
+	Day
+	Month
+	Year
+)
+
+// Truncate returns the UTC start of the period containing t.
+func (g Granularity) Truncate(t time.Time) time.Time {
+	t = t.UTC()
+
+	switch g {
+	case Day:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	case Month:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	case Year:
+		return time.Date(t.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return t.Truncate(time.Hour)
 	}
+}
 
-	if end.After(now) {
-		end = time.Date(currentHour.Year(), currentHour.Month(), currentHour.Day(), currentHour.Hour(), 0, 0, 0, currentHour.Location())
+// Next returns the start of the period following the one starting at t.
+func (g Granularity) Next(t time.Time) time.Time {
+	switch g {
+	case Day:
+		return t.AddDate(0, 0, 1)
+	case Month:
+		return t.AddDate(0, 1, 0)
+	case Year:
+		return t.AddDate(1, 0, 0)
+	default:
+		return t.Add(time.Hour)
 	}
+}
 
+// GetDateTimeRange returns the UTC start of every period of the given granularity that overlaps the
+// half-open range [start, end), in ascending order. Periods that have not ended by now are left out,
+// since the datafeed only publishes complete periods. The result does not depend on the locations of
+// start, end and now.
+func GetDateTimeRange(start, end, now time.Time, granularity Granularity) []time.Time {
 	var times []time.Time
-	for t := time.Date(start.Year(), start.Month(), start.Day(), start.Hour(), 0, 0, 0, start.Location()); t.Before(end); t =
-		t.Add(time.Duration(hourInterval) * time.Hour) {
+	for t := granularity.Truncate(start); t.Before(end); t = granularity.Next(t) {
+		if granularity.Next(t).After(now) {
+			break
+		}
+
 		times = append(times, t)
 	}
+
 	return times
 }
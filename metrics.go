@@ -0,0 +1,147 @@
+package downloader
+
+import (
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/internal/parser"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StageMetrics tracks the hours waiting for and being processed by a single pipeline stage.
+type StageMetrics struct {
+	queued    atomic.Int64
+	active    atomic.Int64
+	completed atomic.Int64
+}
+
+// QueueDepth returns the number of hours waiting to be picked up by the stage.
+func (s *StageMetrics) QueueDepth() int64 {
+	return s.queued.Load()
+}
+
+// Active returns the number of hours currently being processed by the stage.
+func (s *StageMetrics) Active() int64 {
+	return s.active.Load()
+}
+
+// Completed returns the number of hours the stage has finished processing.
+func (s *StageMetrics) Completed() int64 {
+	return s.completed.Load()
+}
+
+func (s *StageMetrics) enqueue() {
+	s.queued.Add(1)
+}
+
+func (s *StageMetrics) dequeue() {
+	s.queued.Add(-1)
+}
+
+func (s *StageMetrics) start() {
+	s.queued.Add(-1)
+	s.active.Add(1)
+}
+
+func (s *StageMetrics) finish() {
+	s.active.Add(-1)
+	s.completed.Add(1)
+}
+
+// Metrics exposes per-stage counters of the download pipeline.
+// Fetch covers the network fetchers, Decode the LZMA decode workers and
+// Output the hours waiting to be delivered to the consumer in order.
+// Metrics also accumulate the transfer statistics summarized by Stats.
+type Metrics struct {
+	Fetch  StageMetrics
+	Decode StageMetrics
+	Output StageMetrics
+
+	compressedBytes   atomic.Int64
+	decompressedBytes atomic.Int64
+	ticks             atomic.Int64
+	retries           atomic.Int64
+	elapsed           atomic.Int64
+
+	mu        sync.Mutex
+	latencies []time.Duration
+}
+
+// NewMetrics returns a zeroed Metrics instance ready to be attached to a Downloader.
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// Stats summarizes a download.
+type Stats struct {
+	// Hours is the number of hours fetched.
+	Hours int64
+	// CompressedBytes is the number of LZMA bytes received, after any content decoding.
+	CompressedBytes int64
+	// DecompressedBytes is the number of raw tick bytes decoded.
+	DecompressedBytes int64
+	// Ticks is the number of ticks within the requested range.
+	Ticks int64
+	// Retries is the number of request attempts that were retried.
+	Retries int64
+	// Duration is the wall time spent downloading.
+	Duration time.Duration
+	// Throughput is the number of compressed bytes received per second.
+	Throughput float64
+	// LatencyP50 and LatencyP95 are percentiles of the time taken to fetch an hour, retries included.
+	LatencyP50 time.Duration
+	LatencyP95 time.Duration
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d hours, %d ticks, %d bytes compressed, %d bytes decompressed, %d retries in %s (%.0f B/s, p50 %s, p95 %s)",
+		s.Hours, s.Ticks, s.CompressedBytes, s.DecompressedBytes, s.Retries, s.Duration.Round(time.Millisecond),
+		s.Throughput, s.LatencyP50.Round(time.Millisecond), s.LatencyP95.Round(time.Millisecond))
+}
+
+// Stats returns a summary of the downloads recorded so far.
+func (m *Metrics) Stats() Stats {
+	m.mu.Lock()
+	latencies := slices.Clone(m.latencies)
+	m.mu.Unlock()
+	slices.Sort(latencies)
+
+	stats := Stats{
+		Hours:             int64(len(latencies)),
+		CompressedBytes:   m.compressedBytes.Load(),
+		DecompressedBytes: m.decompressedBytes.Load(),
+		Ticks:             m.ticks.Load(),
+		Retries:           m.retries.Load(),
+		Duration:          time.Duration(m.elapsed.Load()),
+		LatencyP50:        percentile(latencies, 0.5),
+		LatencyP95:        percentile(latencies, 0.95),
+	}
+
+	if stats.Duration > 0 {
+		stats.Throughput = float64(stats.CompressedBytes) / stats.Duration.Seconds()
+	}
+
+	return stats
+}
+
+func (m *Metrics) observeFetch(latency time.Duration, compressedBytes int) {
+	m.compressedBytes.Add(int64(compressedBytes))
+
+	m.mu.Lock()
+	m.latencies = append(m.latencies, latency)
+	m.mu.Unlock()
+}
+
+func (m *Metrics) observeDecode(decodedTicks int, deliveredTicks int) {
+	m.decompressedBytes.Add(int64(decodedTicks * parser.TickBytes))
+	m.ticks.Add(int64(deliveredTicks))
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	return sorted[int(p*float64(len(sorted)-1))]
+}
@@ -0,0 +1,345 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/internal/parser"
+	"github.com/condrove10/dukascopy-downloader/retryablehttp"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"sync"
+	"time"
+)
+
+// maxDecodeAttempts bounds how often an hour is fetched when its payload fails to decode.
+const maxDecodeAttempts = 3
+
+// hourJob carries a single hour through the fetch, decode and output stages.
+type hourJob struct {
+	index int
+	date  time.Time
+	data  []byte
+	ticks []*tick.Tick
+	// attempts is the number of payloads of the hour that failed to decode.
+	attempts int
+}
+
+// pipeline runs the download as three bounded stages: network fetchers,
+// a decode worker pool and an output stage that delivers hours in order.
+type pipeline struct {
+	d       *Downloader
+	client  *retryablehttp.Client
+	metrics *Metrics
+	ctx     context.Context
+	cancel  context.CancelFunc
+	errOnce sync.Once
+	err     error
+	// inflight counts the hours scheduled and not yet through the decode stage, which may send them back.
+	inflight sync.WaitGroup
+}
+
+func newPipeline(d *Downloader, metrics *Metrics) *pipeline {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var middleware []retryablehttp.Middleware
+	if limiter := d.bandwidthLimiter(); limiter != nil {
+		middleware = append(middleware, retryablehttp.Throttle(limiter))
+	}
+
+	return &pipeline{
+		d:       d,
+		client:  d.newClient(middleware...),
+		metrics: metrics,
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// fail records the first error and stops every stage.
+// Errors raised after the pipeline was cancelled are a consequence of the
+// cancellation and are ignored.
+func (p *pipeline) fail(err error) {
+	if p.ctx.Err() != nil {
+		return
+	}
+
+	p.errOnce.Do(func() {
+		p.err = err
+		p.cancel()
+	})
+}
+
+// run pushes the ticks of every date into out, in date order, and returns the first error encountered.
+func (p *pipeline) run(dates []time.Time, out chan<- *tick.Tick) error {
+	defer p.cancel()
+
+	start := time.Now()
+	defer func() {
+		p.metrics.elapsed.Add(int64(time.Since(start)))
+	}()
+
+	if p.d.CircuitBreaker != nil {
+		unsubscribe := p.d.CircuitBreaker.Subscribe(func(from, to retryablehttp.CircuitState) {
+			p.d.emit(Event{Type: EventCircuitStateChange, From: from, To: to})
+		})
+		defer unsubscribe()
+	}
+
+	fetchConcurrency := p.d.Concurrency
+	decodeConcurrency := p.d.decodeConcurrency()
+	queueSize := p.d.queueSize()
+
+	// The window bounds the number of hours held in memory across all stages,
+	// so a slow consumer eventually stalls the fetchers instead of buffering the whole range.
+	window := make(chan struct{}, fetchConcurrency+decodeConcurrency+queueSize)
+	fetchCh := make(chan *hourJob, queueSize)
+	decodeCh := make(chan *hourJob, queueSize)
+	outputCh := make(chan *hourJob, queueSize)
+	// Hours whose payload failed to decode go back to the fetchers. They hold a window slot, so the
+	// buffer fits every hour in flight and the decode workers never block on it.
+	refetchCh := make(chan *hourJob, cap(window))
+
+	// The fetchers stop once every hour was scheduled and none can be sent back to them.
+	settled := make(chan struct{})
+	go func() {
+		p.schedule(dates, window, fetchCh)
+		p.inflight.Wait()
+		close(settled)
+	}()
+
+	var fetchWg sync.WaitGroup
+	for i := 0; i < fetchConcurrency; i++ {
+		fetchWg.Add(1)
+		go func() {
+			defer fetchWg.Done()
+			p.fetchWorker(fetchCh, refetchCh, settled, decodeCh)
+		}()
+	}
+
+	go func() {
+		fetchWg.Wait()
+		close(decodeCh)
+	}()
+
+	var decodeWg sync.WaitGroup
+	for i := 0; i < decodeConcurrency; i++ {
+		decodeWg.Add(1)
+		go func() {
+			defer decodeWg.Done()
+			p.decodeWorker(decodeCh, refetchCh, outputCh)
+		}()
+	}
+
+	go func() {
+		decodeWg.Wait()
+		close(outputCh)
+	}()
+
+	p.output(outputCh, window, out)
+
+	return p.err
+}
+
+func (p *pipeline) schedule(dates []time.Time, window chan struct{}, fetchCh chan<- *hourJob) {
+	defer close(fetchCh)
+
+	for i, date := range dates {
+		select {
+		case window <- struct{}{}:
+		case <-p.ctx.Done():
+			return
+		}
+
+		if p.pauseWhileOpen() {
+			if err := p.d.CircuitBreaker.Wait(p.ctx); err != nil {
+				return
+			}
+		}
+
+		p.metrics.Fetch.enqueue()
+		p.inflight.Add(1)
+		select {
+		case fetchCh <- &hourJob{index: i, date: date}:
+		case <-p.ctx.Done():
+			p.metrics.Fetch.dequeue()
+			p.inflight.Done()
+			return
+		}
+	}
+}
+
+// fetchWorker fetches the scheduled hours and the hours sent back by the decode stage until settled is closed.
+func (p *pipeline) fetchWorker(fetchCh <-chan *hourJob, refetchCh <-chan *hourJob, settled <-chan struct{}, decodeCh chan<- *hourJob) {
+	for {
+		var job *hourJob
+		select {
+		case scheduled, ok := <-fetchCh:
+			if !ok {
+				fetchCh = nil
+				continue
+			}
+			job = scheduled
+		case job = <-refetchCh:
+		case <-settled:
+			return
+		}
+
+		if !p.fetchJob(job, decodeCh) {
+			p.inflight.Done()
+		}
+	}
+}
+
+// fetchJob fetches the payload of job and passes it to the decode stage, reporting whether it did.
+func (p *pipeline) fetchJob(job *hourJob, decodeCh chan<- *hourJob) bool {
+	p.metrics.Fetch.start()
+	if p.ctx.Err() != nil {
+		p.metrics.Fetch.finish()
+		return false
+	}
+
+	start := time.Now()
+	data, err := p.fetch(job.date)
+	p.metrics.Fetch.finish()
+	if err != nil {
+		p.fail(fmt.Errorf("failed to fetch ticks for date %s: %w", job.date, err))
+		return false
+	}
+	p.metrics.observeFetch(time.Since(start), len(data))
+
+	job.data = data
+	p.metrics.Decode.enqueue()
+	select {
+	case decodeCh <- job:
+		return true
+	case <-p.ctx.Done():
+		p.metrics.Decode.dequeue()
+		return false
+	}
+}
+
+// fetch downloads a single hour, waiting out an open circuit breaker and trying again when configured to.
+func (p *pipeline) fetch(date time.Time) ([]byte, error) {
+	for {
+		data, err := p.request(date)
+		if err == nil || !p.pauseWhileOpen() || !errors.Is(err, retryablehttp.ErrCircuitOpen) {
+			return data, err
+		}
+
+		if err := p.d.CircuitBreaker.Wait(p.ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *pipeline) request(date time.Time) ([]byte, error) {
+	url := p.d.url(date)
+
+	client := p.client.WithContext(p.ctx).WithUrl(url).
+		WithOnRetry(func(attempt int, delay time.Duration, cause error) {
+			p.metrics.retries.Add(1)
+			p.d.emit(Event{Type: EventRetry, Hour: date, Attempt: attempt, Delay: delay, Err: cause})
+		})
+
+	resp, err := client.DoAndRead()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching data for url '%s': %w", url, err)
+	}
+
+	return resp.Body, nil
+}
+
+func (p *pipeline) pauseWhileOpen() bool {
+	return p.d.PauseWhileOpen && p.d.CircuitBreaker != nil
+}
+
+// decodeWorker decodes fetched hours, sending an hour back to the fetchers when its payload fails to
+// decode, e.g. a body cut short, until maxDecodeAttempts payloads failed.
+func (p *pipeline) decodeWorker(decodeCh <-chan *hourJob, refetchCh chan<- *hourJob, outputCh chan<- *hourJob) {
+	for job := range decodeCh {
+		if p.decodeJob(job, refetchCh, outputCh) {
+			continue
+		}
+		p.inflight.Done()
+	}
+}
+
+// decodeJob decodes job and passes it to the output stage, reporting whether it was sent back to the fetchers instead.
+func (p *pipeline) decodeJob(job *hourJob, refetchCh chan<- *hourJob, outputCh chan<- *hourJob) bool {
+	p.metrics.Decode.start()
+	if p.ctx.Err() != nil {
+		p.metrics.Decode.finish()
+		return false
+	}
+
+	parsedTicks, err := parser.Decode(job.data, p.d.Symbol, job.date)
+	p.metrics.Decode.finish()
+	if err != nil {
+		job.attempts++
+		if job.attempts >= maxDecodeAttempts {
+			p.fail(fmt.Errorf("failed to decode ticks for date %s: %w", job.date, err))
+			return false
+		}
+
+		p.metrics.retries.Add(1)
+		p.d.emit(Event{Type: EventRetry, Hour: job.date, Attempt: job.attempts, Err: err})
+
+		job.data = nil
+		p.metrics.Fetch.enqueue()
+		refetchCh <- job
+		return true
+	}
+
+	ticks := p.d.filterTicksForDate(parsedTicks, job.date)
+	p.metrics.observeDecode(len(parsedTicks), len(ticks))
+
+	job.data = nil
+	job.ticks = ticks
+	p.metrics.Output.enqueue()
+	select {
+	case outputCh <- job:
+	case <-p.ctx.Done():
+		p.metrics.Output.dequeue()
+	}
+
+	return false
+}
+
+// output reorders decoded hours and delivers their ticks to out, releasing a window slot per hour.
+func (p *pipeline) output(outputCh <-chan *hourJob, window <-chan struct{}, out chan<- *tick.Tick) {
+	pending := make(map[int]*hourJob)
+	next := 0
+
+	for job := range outputCh {
+		pending[job.index] = job
+
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+
+			delete(pending, next)
+			next++
+
+			p.metrics.Output.start()
+			for _, t := range ready.ticks {
+				select {
+				case out <- t:
+				case <-p.ctx.Done():
+				}
+
+				if p.ctx.Err() != nil {
+					break
+				}
+			}
+			p.metrics.Output.finish()
+
+			<-window
+		}
+	}
+
+	for range pending {
+		p.metrics.Output.dequeue()
+	}
+}
@@ -0,0 +1,186 @@
+package downloader
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// HourCache reports whether the data behind an hour URL is already available locally.
+type HourCache interface {
+	Has(url string) bool
+}
+
+// Estimate holds the average cost of fetching one hour of a symbol.
+type Estimate struct {
+	BytesPerHour   int64
+	LatencyPerHour time.Duration
+}
+
+// DefaultEstimate is used for symbols without a historical estimate. It reflects a liquid FX pair.
+var DefaultEstimate = Estimate{
+	BytesPerHour:   32 << 10,
+	LatencyPerHour: 400 * time.Millisecond,
+}
+
+// EstimateFromStats derives an estimate from the statistics of an earlier download of the same symbol.
+func EstimateFromStats(stats Stats) Estimate {
+	if stats.Hours == 0 {
+		return DefaultEstimate
+	}
+
+	return Estimate{
+		BytesPerHour:   stats.CompressedBytes / stats.Hours,
+		LatencyPerHour: stats.LatencyP50,
+	}
+}
+
+// StatsFile holds the statistics of the latest download of every symbol, keyed by symbol.
+// It is saved as JSON so that later plans can estimate from it.
+type StatsFile map[string]Stats
+
+// LoadStatsFile reads the statistics saved at path; a missing file yields an empty StatsFile.
+func LoadStatsFile(path string) (StatsFile, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return StatsFile{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats file %s: %w", path, err)
+	}
+
+	stats := StatsFile{}
+	if err := json.Unmarshal(data, &stats); err != nil {
+		return nil, fmt.Errorf("failed to decode stats file %s: %w", path, err)
+	}
+
+	return stats, nil
+}
+
+// Save writes the statistics to path, replacing it atomically.
+func (f StatsFile) Save(path string) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode stats file %s: %w", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write stats file %s: %w", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write stats file %s: %w", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write stats file %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write stats file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// Estimates returns the estimate derived from the statistics of every symbol, for PlanOptions.Estimates.
+func (f StatsFile) Estimates() map[string]Estimate {
+	estimates := make(map[string]Estimate, len(f))
+	for symbol, stats := range f {
+		estimates[symbol] = EstimateFromStats(stats)
+	}
+
+	return estimates
+}
+
+type PlanOptions struct {
+	// Cache, when set, marks the hours that do not need to be fetched.
+	Cache HourCache
+	// Estimates holds historical per-symbol estimates; missing symbols use DefaultEstimate.
+	Estimates map[string]Estimate
+}
+
+type PlannedHour struct {
+	Hour   time.Time
+	Url    string
+	Cached bool
+}
+
+// Plan describes what a download would do without performing it.
+type Plan struct {
+	Symbol string
+	Hours  []PlannedHour
+	// Requests is the number of hours that are not cached and would be requested.
+	Requests int
+	// CachedHours is the number of hours already available in the cache.
+	CachedHours    int
+	EstimatedBytes int64
+	// EstimatedDuration is bounded below by the time the bandwidth limit, or shared limiter, needs for EstimatedBytes.
+	EstimatedDuration time.Duration
+}
+
+// Plan enumerates every hour the downloader would fetch and estimates the cost of fetching the missing ones.
+func (d *Downloader) Plan(options PlanOptions) (*Plan, error) {
+	if err := d.validate(); err != nil {
+		return nil, err
+	}
+
+	estimate, ok := options.Estimates[d.Symbol]
+	if !ok {
+		estimate = DefaultEstimate
+	}
+
+	plan := &Plan{
+		Symbol: d.Symbol,
+	}
+
+	for _, date := range d.hours() {
+		url := d.url(date)
+		cached := options.Cache != nil && options.Cache.Has(url)
+
+		plan.Hours = append(plan.Hours, PlannedHour{Hour: date, Url: url, Cached: cached})
+		if cached {
+			plan.CachedHours++
+			continue
+		}
+
+		plan.Requests++
+	}
+
+	plan.EstimatedBytes = int64(plan.Requests) * estimate.BytesPerHour
+	plan.EstimatedDuration = time.Duration(plan.Requests) * estimate.LatencyPerHour / time.Duration(d.Concurrency)
+	if limiter := d.bandwidthLimiter(); limiter != nil && limiter.Rate() > 0 {
+		transfer := time.Duration(float64(plan.EstimatedBytes) / limiter.Rate() * float64(time.Second))
+		plan.EstimatedDuration = max(plan.EstimatedDuration, transfer)
+	}
+
+	return plan, nil
+}
+
+// Write prints the plan summary to w, preceded by every hour URL and its cache status if listUrls is set.
+func (p *Plan) Write(w io.Writer, listUrls bool) error {
+	if listUrls {
+		for _, hour := range p.Hours {
+			status := "missing"
+			if hour.Cached {
+				status = "cached"
+			}
+
+			if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", hour.Hour.UTC().Format(time.RFC3339), status, hour.Url); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%s: %d hours, %d cached, %d requests, ~%d bytes, ~%s\n",
+		p.Symbol, len(p.Hours), p.CachedHours, p.Requests, p.EstimatedBytes, p.EstimatedDuration.Round(time.Second))
+
+	return err
+}
@@ -0,0 +1,90 @@
+package downloader
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/condrove10/dukascopy-downloader/retryablehttp"
+)
+
+func TestStatsFileEstimates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stats.json")
+
+	empty, err := LoadStatsFile(path)
+	if err != nil {
+		t.Fatalf("LoadStatsFile of a missing file: %v", err)
+	}
+	if len(empty) != 0 {
+		t.Fatalf("got %d symbols from a missing file", len(empty))
+	}
+
+	saved := StatsFile{"EURUSD": {Hours: 10, CompressedBytes: 50_000, LatencyP50: 200 * time.Millisecond}}
+	if err := saved.Save(path); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded, err := LoadStatsFile(path)
+	if err != nil {
+		t.Fatalf("LoadStatsFile: %v", err)
+	}
+	if loaded["EURUSD"] != saved["EURUSD"] {
+		t.Fatalf("got %+v, want %+v", loaded["EURUSD"], saved["EURUSD"])
+	}
+
+	d := &Downloader{
+		Symbol:      "EURUSD",
+		StartTime:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2024, 1, 2, 4, 0, 0, 0, time.UTC),
+		Concurrency: 2,
+		HttpClient:  http.DefaultClient,
+	}
+	plan, err := d.Plan(PlanOptions{Estimates: loaded.Estimates()})
+	if err != nil {
+		t.Fatalf("Plan: %v", err)
+	}
+	if plan.EstimatedBytes != 4*5_000 {
+		t.Errorf("got %d estimated bytes, want %d", plan.EstimatedBytes, 4*5_000)
+	}
+	if plan.EstimatedDuration != 400*time.Millisecond {
+		t.Errorf("got estimated duration %s, want 400ms", plan.EstimatedDuration)
+	}
+}
+
+func TestPlanBandwidthEstimate(t *testing.T) {
+	d := &Downloader{
+		Symbol:      "EURUSD",
+		StartTime:   time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC),
+		EndTime:     time.Date(2024, 1, 2, 3, 0, 0, 0, time.UTC),
+		Concurrency: 3,
+		HttpClient:  http.DefaultClient,
+	}
+	estimates := map[string]Estimate{"EURUSD": {BytesPerHour: 500, LatencyPerHour: 100 * time.Millisecond}}
+
+	tests := []struct {
+		name    string
+		limit   int64
+		limiter *retryablehttp.BandwidthLimiter
+		want    time.Duration
+	}{
+		{name: "no limit", want: 100 * time.Millisecond},
+		{name: "bandwidth limit", limit: 1000, want: 1500 * time.Millisecond},
+		{name: "shared limiter", limiter: retryablehttp.NewBandwidthLimiter(4000), want: 375 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dl := *d
+			dl.BandwidthLimit, dl.BandwidthLimiter = tt.limit, tt.limiter
+
+			plan, err := dl.Plan(PlanOptions{Estimates: estimates})
+			if err != nil {
+				t.Fatalf("Plan: %v", err)
+			}
+			if plan.EstimatedDuration != tt.want {
+				t.Fatalf("got estimated duration %s, want %s", plan.EstimatedDuration, tt.want)
+			}
+		})
+	}
+}
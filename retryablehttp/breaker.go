@@ -0,0 +1,296 @@
+package retryablehttp
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the cause recorded for attempts rejected because the circuit breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreaker.
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through while tracking the failure ratio.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request until the open duration has elapsed.
+	CircuitOpen
+	// CircuitHalfOpen lets a limited number of probe requests through to decide whether to close again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig configures a CircuitBreaker; zero fields take the documented defaults.
+type CircuitBreakerConfig struct {
+	// FailureRatio is the ratio of failed requests in the window that opens the circuit. Defaults to 0.5.
+	FailureRatio float64
+	// Window is the number of most recent requests the failure ratio is computed over. Defaults to 20.
+	Window int
+	// MinRequests is the number of requests the window must hold before the circuit may open. Defaults to 10.
+	MinRequests int
+	// OpenDuration is how long the circuit stays open before probing. Defaults to 30 seconds.
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of successful probes needed to close the circuit again. Defaults to 1.
+	HalfOpenProbes int
+}
+
+// CircuitBreaker guards a host shared by many requests. It opens once the failure ratio over the
+// recent requests reaches the configured threshold, rejects requests while open, and lets probe
+// requests through once the open duration has elapsed. A CircuitBreaker is safe for concurrent use.
+type CircuitBreaker struct {
+	config CircuitBreakerConfig
+
+	mu          sync.Mutex
+	state       CircuitState
+	generation  uint64
+	results     []bool
+	next        int
+	failures    int
+	openUntil   time.Time
+	probes      int
+	successes   int
+	subscribers map[int]func(from, to CircuitState)
+	nextID      int
+	changes     [][2]CircuitState
+	changed     chan struct{}
+}
+
+func NewCircuitBreaker(config CircuitBreakerConfig) *CircuitBreaker {
+	if config.FailureRatio == 0 {
+		config.FailureRatio = 0.5
+	}
+	if config.Window == 0 {
+		config.Window = 20
+	}
+	if config.MinRequests == 0 {
+		config.MinRequests = 10
+	}
+	if config.OpenDuration == 0 {
+		config.OpenDuration = 30 * time.Second
+	}
+	if config.HalfOpenProbes == 0 {
+		config.HalfOpenProbes = 1
+	}
+
+	return &CircuitBreaker{
+		config:      config,
+		results:     make([]bool, 0, config.Window),
+		subscribers: make(map[int]func(from, to CircuitState)),
+		changed:     make(chan struct{}),
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *CircuitBreaker) State() CircuitState {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.advance(time.Now())
+	return b.state
+}
+
+// Subscribe registers fn to be called on every state change and returns a function removing it.
+// fn is called synchronously by the goroutine that caused the change, after the breaker was unlocked.
+func (b *CircuitBreaker) Subscribe(fn func(from, to CircuitState)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = fn
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.subscribers, id)
+	}
+}
+
+// Allow reports whether a request may be sent. On success it returns the function the caller
+// must use to report whether the request succeeded; otherwise it returns ErrCircuitOpen.
+func (b *CircuitBreaker) Allow() (func(success bool), error) {
+	generation, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(success bool) {
+		b.record(generation, success)
+	}, nil
+}
+
+// allow is Allow returning the generation the request was allowed in, for record or release.
+func (b *CircuitBreaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	b.advance(time.Now())
+
+	switch b.state {
+	case CircuitOpen:
+		return 0, ErrCircuitOpen
+	case CircuitHalfOpen:
+		if b.probes >= b.config.HalfOpenProbes {
+			return 0, ErrCircuitOpen
+		}
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// release gives back a request allowed in generation without recording a result, e.g. one cancelled by
+// its caller, which says nothing about the host. A half-open breaker may then let another probe through.
+func (b *CircuitBreaker) release(generation uint64) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	if generation == b.generation && b.state == CircuitHalfOpen && b.probes > 0 {
+		b.probes--
+		// Wake callers waiting for the probe slot.
+		close(b.changed)
+		b.changed = make(chan struct{})
+	}
+}
+
+// Wait blocks until the breaker would allow a request or ctx is done.
+func (b *CircuitBreaker) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.advance(now)
+		if b.state == CircuitClosed || (b.state == CircuitHalfOpen && b.probes < b.config.HalfOpenProbes) {
+			b.unlock()
+			return nil
+		}
+
+		changed := b.changed
+		var timer *time.Timer
+		var expired <-chan time.Time
+		if b.state == CircuitOpen {
+			timer = time.NewTimer(b.openUntil.Sub(now))
+			expired = timer.C
+		}
+		b.unlock()
+
+		var err error
+		select {
+		case <-expired:
+		case <-changed:
+		case <-ctx.Done():
+			err = ctx.Err()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (b *CircuitBreaker) record(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.unlock()
+
+	// Results of requests allowed before the last state change no longer describe the host.
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case CircuitClosed:
+		if len(b.results) < b.config.Window {
+			b.results = append(b.results, success)
+		} else {
+			if !b.results[b.next] {
+				b.failures--
+			}
+			b.results[b.next] = success
+			b.next = (b.next + 1) % b.config.Window
+		}
+		if !success {
+			b.failures++
+		}
+
+		if len(b.results) >= b.config.MinRequests &&
+			float64(b.failures)/float64(len(b.results)) >= b.config.FailureRatio {
+			b.transition(CircuitOpen, time.Now())
+		}
+
+	case CircuitHalfOpen:
+		if !success {
+			b.transition(CircuitOpen, time.Now())
+			return
+		}
+
+		b.successes++
+		if b.successes >= b.config.HalfOpenProbes {
+			b.transition(CircuitClosed, time.Now())
+		}
+	}
+}
+
+// advance moves an open breaker to half-open once its open duration has elapsed.
+func (b *CircuitBreaker) advance(now time.Time) {
+	if b.state == CircuitOpen && !now.Before(b.openUntil) {
+		b.transition(CircuitHalfOpen, now)
+	}
+}
+
+func (b *CircuitBreaker) transition(to CircuitState, now time.Time) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.results = b.results[:0]
+	b.next = 0
+	b.failures = 0
+	b.probes = 0
+	b.successes = 0
+
+	if to == CircuitOpen {
+		b.openUntil = now.Add(b.config.OpenDuration)
+	}
+
+	b.changes = append(b.changes, [2]CircuitState{from, to})
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+// unlock releases the breaker and then notifies subscribers of the state changes made while it was held.
+func (b *CircuitBreaker) unlock() {
+	changes := b.changes
+	b.changes = nil
+
+	var subscribers []func(from, to CircuitState)
+	if len(changes) > 0 {
+		for _, fn := range b.subscribers {
+			subscribers = append(subscribers, fn)
+		}
+	}
+	b.mu.Unlock()
+
+	for _, change := range changes {
+		for _, fn := range subscribers {
+			fn(change[0], change[1])
+		}
+	}
+}
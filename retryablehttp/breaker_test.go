@@ -0,0 +1,208 @@
+package retryablehttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+// allow calls Allow and fails the test if the breaker rejects the request.
+func allow(t *testing.T, b *CircuitBreaker) func(success bool) {
+	t.Helper()
+
+	report, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow in state %s: %v", b.State(), err)
+	}
+
+	return report
+}
+
+func wantState(t *testing.T, b *CircuitBreaker, want CircuitState) {
+	t.Helper()
+
+	if got := b.State(); got != want {
+		t.Fatalf("got state %s, want %s", got, want)
+	}
+}
+
+func TestCircuitBreakerRatioWindow(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []bool
+		want    CircuitState
+	}{
+		{name: "below min requests", results: []bool{false, false, false}, want: CircuitClosed},
+		{name: "below ratio", results: []bool{true, true, true, false, true, true}, want: CircuitClosed},
+		{name: "ratio reached", results: []bool{true, false, true, false}, want: CircuitOpen},
+		{name: "failures slid out of the window", results: []bool{false, true, true, true, true, false}, want: CircuitClosed},
+		{name: "failures within the window", results: []bool{true, true, true, true, true, false, false}, want: CircuitOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewCircuitBreaker(CircuitBreakerConfig{FailureRatio: 0.3, Window: 4, MinRequests: 4, OpenDuration: time.Hour})
+			for _, success := range tt.results {
+				report, err := b.Allow()
+				if err != nil {
+					break
+				}
+				report(success)
+			}
+
+			wantState(t, b, tt.want)
+		})
+	}
+}
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+	b := NewCircuitBreaker(CircuitBreakerConfig{Window: 2, MinRequests: 2, OpenDuration: openDuration})
+
+	allow(t, b)(false)
+	allow(t, b)(false)
+	wantState(t, b, CircuitOpen)
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("an open breaker allowed a request: %v", err)
+	}
+
+	time.Sleep(openDuration)
+	wantState(t, b, CircuitHalfOpen)
+
+	// A failed probe opens the breaker again.
+	allow(t, b)(false)
+	wantState(t, b, CircuitOpen)
+
+	time.Sleep(openDuration)
+	allow(t, b)(true)
+	wantState(t, b, CircuitClosed)
+}
+
+func TestCircuitBreakerProbeBudget(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+	b := NewCircuitBreaker(CircuitBreakerConfig{Window: 1, MinRequests: 1, OpenDuration: openDuration, HalfOpenProbes: 2})
+
+	allow(t, b)(false)
+	time.Sleep(openDuration)
+
+	first := allow(t, b)
+	second := allow(t, b)
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("a half-open breaker allowed more probes than its budget: %v", err)
+	}
+
+	first(true)
+	wantState(t, b, CircuitHalfOpen)
+	second(true)
+	wantState(t, b, CircuitClosed)
+}
+
+func TestCircuitBreakerDiscardsStaleResults(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+	b := NewCircuitBreaker(CircuitBreakerConfig{Window: 2, MinRequests: 2, OpenDuration: openDuration})
+
+	stale := allow(t, b)
+	allow(t, b)(false)
+	allow(t, b)(false)
+	wantState(t, b, CircuitOpen)
+
+	time.Sleep(openDuration)
+	wantState(t, b, CircuitHalfOpen)
+
+	// A success from before the breaker opened must not close it.
+	stale(true)
+	wantState(t, b, CircuitHalfOpen)
+
+	probe := allow(t, b)
+	b.release(0)
+	if _, err := b.Allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("releasing a request from an earlier generation freed a probe")
+	}
+	probe(true)
+	wantState(t, b, CircuitClosed)
+}
+
+func TestCircuitBreakerSubscribe(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+	b := NewCircuitBreaker(CircuitBreakerConfig{Window: 1, MinRequests: 1, OpenDuration: openDuration})
+
+	var mu sync.Mutex
+	var changes [][2]CircuitState
+	unsubscribe := b.Subscribe(func(from, to CircuitState) {
+		// The breaker is unlocked while subscribers run.
+		b.State()
+
+		mu.Lock()
+		defer mu.Unlock()
+		changes = append(changes, [2]CircuitState{from, to})
+	})
+
+	allow(t, b)(false)
+	time.Sleep(openDuration)
+	allow(t, b)(true)
+
+	unsubscribe()
+	allow(t, b)(false)
+
+	want := [][2]CircuitState{{CircuitClosed, CircuitOpen}, {CircuitOpen, CircuitHalfOpen}, {CircuitHalfOpen, CircuitClosed}}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(changes) != len(want) {
+		t.Fatalf("got changes %v, want %v", changes, want)
+	}
+	for i := range want {
+		if changes[i] != want[i] {
+			t.Fatalf("got changes %v, want %v", changes, want)
+		}
+	}
+}
+
+func TestCircuitBreakerWait(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+	b := NewCircuitBreaker(CircuitBreakerConfig{Window: 1, MinRequests: 1, OpenDuration: openDuration})
+	allow(t, b)(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := b.Wait(ctx); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	wantState(t, b, CircuitHalfOpen)
+
+	// With the only probe taken, Wait blocks until it is released.
+	allow(t, b)
+	ctx, cancel = context.WithTimeout(context.Background(), openDuration)
+	defer cancel()
+	if err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait returned %v while the probe was taken", err)
+	}
+}
+
+// cancelTransport fails every request as cancelled by its caller.
+type cancelTransport struct{}
+
+func (cancelTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, context.Canceled
+}
+
+func TestCancelledProbeIsNotReported(t *testing.T) {
+	const openDuration = 20 * time.Millisecond
+	b := NewCircuitBreaker(CircuitBreakerConfig{Window: 1, MinRequests: 1, OpenDuration: openDuration})
+	allow(t, b)(false)
+	time.Sleep(openDuration)
+	wantState(t, b, CircuitHalfOpen)
+
+	_, err := DefaultClient.WithHttpClient(&http.Client{Transport: cancelTransport{}}).WithMethod(MethodGet).
+		WithUrl("http://example.test/").WithMaxRetries(1).WithCircuitBreaker(b).Do()
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+
+	// The cancelled probe neither closed the breaker nor kept its probe slot.
+	wantState(t, b, CircuitHalfOpen)
+	allow(t, b)(true)
+	wantState(t, b, CircuitClosed)
+}
@@ -0,0 +1,146 @@
+package retryablehttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Outcome is the classification of a single attempt.
+type Outcome int
+
+const (
+	// OutcomeSuccess means the attempt produced a usable response.
+	OutcomeSuccess Outcome = iota
+	// OutcomeRetryable means the attempt failed in a way that may succeed when repeated.
+	OutcomeRetryable
+	// OutcomePermanent means the attempt failed in a way that repeating will not fix.
+	OutcomePermanent
+	// OutcomeNotFound means the server reported that the resource does not exist.
+	OutcomeNotFound
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeRetryable:
+		return "retryable"
+	case OutcomePermanent:
+		return "permanent"
+	case OutcomeNotFound:
+		return "not found"
+	default:
+		return fmt.Sprintf("outcome(%d)", int(o))
+	}
+}
+
+// Classifier decides the outcome of an attempt from its response and error.
+// resp may be nil when err is not.
+type Classifier func(resp *http.Response, err error) Outcome
+
+// ErrNotFound matches, through errors.Is, a RetryError whose final attempt was classified as OutcomeNotFound.
+var ErrNotFound = errors.New("resource not found")
+
+// PermanentError is implemented by errors that repeating the request cannot fix, e.g. a cassette
+// replaying a request it never recorded. Errors whose Permanent method returns true are permanent.
+type PermanentError interface {
+	error
+	Permanent() bool
+}
+
+// DefaultClassifier retries network errors, timeouts, 5xx responses, 408 and 429; treats 404 and 410
+// as not found, any other 4xx, a cancelled context and a PermanentError as permanent, and 2xx as success.
+func DefaultClassifier(resp *http.Response, err error) Outcome {
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return OutcomePermanent
+		}
+
+		var permanent PermanentError
+		if errors.As(err, &permanent) && permanent.Permanent() {
+			return OutcomePermanent
+		}
+
+		// Timeouts, connection resets, DNS failures, truncated and rejected bodies are all worth another attempt.
+		return OutcomeRetryable
+	}
+
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		return OutcomeSuccess
+	case code == http.StatusNotFound || code == http.StatusGone:
+		return OutcomeNotFound
+	case code == http.StatusRequestTimeout || code == http.StatusTooManyRequests:
+		return OutcomeRetryable
+	case code >= 400 && code < 500:
+		return OutcomePermanent
+	default:
+		return OutcomeRetryable
+	}
+}
+
+// conditionClassifier adapts a retry condition set through WithRetryCondition.
+func conditionClassifier(condition func(resp *http.Response, err error) bool) Classifier {
+	return func(resp *http.Response, err error) Outcome {
+		if condition(resp, err) || err != nil {
+			return OutcomeRetryable
+		}
+
+		return OutcomeSuccess
+	}
+}
+
+// StatusError is the cause recorded for an attempt that completed with an unsuccessful status code.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %d", e.StatusCode)
+}
+
+// RetryError is returned once a request gives up, either because its retries were exhausted or
+// because an attempt was classified as permanent or not found.
+type RetryError struct {
+	// Attempts holds the cause of every failed attempt, in order.
+	Attempts []error
+	// StatusCode is the status code of the last response received, or zero if none was.
+	StatusCode int
+	// Outcome is the classification of the last attempt.
+	Outcome Outcome
+}
+
+func (e *RetryError) Error() string {
+	var b strings.Builder
+	switch e.Outcome {
+	case OutcomeRetryable:
+		b.WriteString("retryable http client max retries exceeded;")
+	default:
+		fmt.Fprintf(&b, "retryable http client gave up on %s failure;", e.Outcome)
+	}
+
+	for i, err := range e.Attempts {
+		fmt.Fprintf(&b, "\n\t\ttry %d: %v", i+1, err)
+	}
+
+	return b.String()
+}
+
+func (e *RetryError) Unwrap() []error {
+	return e.Attempts
+}
+
+func (e *RetryError) Is(target error) bool {
+	return target == ErrNotFound && e.Outcome == OutcomeNotFound
+}
+
+func (e *RetryError) record(resp *http.Response, cause error, outcome Outcome) {
+	e.Attempts = append(e.Attempts, cause)
+	e.Outcome = outcome
+	if resp != nil && resp.StatusCode != 0 {
+		e.StatusCode = resp.StatusCode
+	}
+}
@@ -0,0 +1,124 @@
+package retryablehttp
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// hedgerWindow is the number of most recent latencies a Hedger keeps.
+	hedgerWindow = 256
+	// hedgerMinSamples is the number of latencies a Hedger needs before it trusts its percentile.
+	hedgerMinSamples = 16
+)
+
+// Hedger computes when a duplicate request should be launched for an attempt that has not completed yet.
+// The delay is the configured percentile of recently observed successful attempt latencies, or the
+// fallback delay until enough latencies were observed. A Hedger is safe for concurrent use.
+type Hedger struct {
+	percentile float64
+	fallback   time.Duration
+
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+// NewHedger returns a Hedger hedging at the given percentile, between 0 and 1, of observed latencies.
+func NewHedger(percentile float64, fallback time.Duration) *Hedger {
+	return &Hedger{
+		percentile: min(max(percentile, 0), 1),
+		fallback:   fallback,
+		samples:    make([]time.Duration, 0, hedgerWindow),
+	}
+}
+
+// Delay returns how long to wait for an attempt before launching its duplicate.
+func (h *Hedger) Delay() time.Duration {
+	h.mu.Lock()
+	if len(h.samples) < hedgerMinSamples {
+		h.mu.Unlock()
+		return h.fallback
+	}
+	sorted := slices.Clone(h.samples)
+	h.mu.Unlock()
+
+	slices.Sort(sorted)
+	return sorted[int(h.percentile*float64(len(sorted)-1))]
+}
+
+// Observe records the latency of a successful attempt.
+func (h *Hedger) Observe(latency time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.samples) < hedgerWindow {
+		h.samples = append(h.samples, latency)
+		return
+	}
+
+	h.samples[h.next] = latency
+	h.next = (h.next + 1) % hedgerWindow
+}
+
+// hedge runs read and, if it has not completed within the hedger delay, a duplicate of it.
+// The first successful result wins and the other request is cancelled; if both fail the last failure is returned.
+func (c *Client) hedge(ctx context.Context, read func(ctx context.Context) attemptResult, classify Classifier) attemptResult {
+	ctx, cancel := context.WithCancel(ctx)
+	results := make(chan attemptResult, 2)
+
+	launch := func() {
+		go func() {
+			start := time.Now()
+			result := read(ctx)
+			if result.err == nil && classify(result.resp, nil) == OutcomeSuccess {
+				c.hedger.Observe(time.Since(start))
+			}
+
+			results <- result
+		}()
+	}
+
+	launch()
+	launched := 1
+
+	timer := time.NewTimer(c.hedger.Delay())
+	defer timer.Stop()
+
+	var last attemptResult
+	for received := 0; received < launched; {
+		select {
+		case <-timer.C:
+			if launched == 1 {
+				launch()
+				launched++
+			}
+
+		case result := <-results:
+			received++
+			if result.err == nil && classify(result.resp, nil) == OutcomeSuccess {
+				cancel()
+				go func(pending int) {
+					for ; pending > 0; pending-- {
+						discard((<-results).resp)
+					}
+				}(launched - received)
+
+				return result
+			}
+
+			discard(last.resp)
+			last = result
+			if launched == 1 {
+				// The request failed before it was worth hedging; leave the decision to the retry loop.
+				cancel()
+				return last
+			}
+		}
+	}
+
+	cancel()
+	return last
+}
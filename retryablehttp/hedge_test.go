@@ -0,0 +1,142 @@
+package retryablehttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sequenceTransport passes every request, numbered from 1 in arrival order, to respond.
+type sequenceTransport struct {
+	calls   atomic.Int64
+	respond func(n int64, r *http.Request) (*http.Response, error)
+}
+
+func (s *sequenceTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return s.respond(s.calls.Add(1), r)
+}
+
+func respond(r *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: statusCode,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    r,
+	}
+}
+
+func hedgedClient(transport http.RoundTripper, hedger *Hedger) *Client {
+	return DefaultClient.WithHttpClient(&http.Client{Transport: transport}).WithMethod(MethodGet).
+		WithUrl("http://example.test/").WithMaxRetries(1).WithRetryDelay(time.Millisecond).WithHedger(hedger)
+}
+
+func TestHedgeSlowPrimary(t *testing.T) {
+	primaryCancelled := make(chan struct{})
+	transport := &sequenceTransport{respond: func(n int64, r *http.Request) (*http.Response, error) {
+		if n == 1 {
+			select {
+			case <-r.Context().Done():
+				close(primaryCancelled)
+				return nil, r.Context().Err()
+			case <-time.After(5 * time.Second):
+				return respond(r, http.StatusOK, "primary"), nil
+			}
+		}
+
+		return respond(r, http.StatusOK, "hedge"), nil
+	}}
+
+	start := time.Now()
+	resp, err := hedgedClient(transport, NewHedger(0.5, 10*time.Millisecond)).DoAndRead()
+	if err != nil {
+		t.Fatalf("DoAndRead: %v", err)
+	}
+	if string(resp.Body) != "hedge" {
+		t.Fatalf("got body %q, want the hedge response", resp.Body)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("the hedged request took %s", elapsed)
+	}
+
+	select {
+	case <-primaryCancelled:
+	case <-time.After(time.Second):
+		t.Fatal("the slow primary was not cancelled")
+	}
+	if n := transport.calls.Load(); n != 2 {
+		t.Fatalf("got %d requests, want 2", n)
+	}
+}
+
+func TestHedgeBothFail(t *testing.T) {
+	transport := &sequenceTransport{respond: func(n int64, r *http.Request) (*http.Response, error) {
+		if n%2 == 1 {
+			// Every primary is slow enough to be hedged.
+			time.Sleep(30 * time.Millisecond)
+		}
+
+		return respond(r, http.StatusServiceUnavailable, ""), nil
+	}}
+
+	_, err := hedgedClient(transport, NewHedger(0.5, 5*time.Millisecond)).DoAndRead()
+
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) {
+		t.Fatalf("got %v, want a RetryError", err)
+	}
+	if retryErr.Outcome != OutcomeRetryable || retryErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("got outcome %s and status %d", retryErr.Outcome, retryErr.StatusCode)
+	}
+	if len(retryErr.Attempts) != 2 {
+		t.Fatalf("got %d attempts, want 2", len(retryErr.Attempts))
+	}
+	if n := transport.calls.Load(); n != 4 {
+		t.Fatalf("got %d requests, want a primary and a hedge per attempt", n)
+	}
+}
+
+func TestHedgeAttemptTimeoutIsRetried(t *testing.T) {
+	transport := &sequenceTransport{respond: func(n int64, r *http.Request) (*http.Response, error) {
+		if n <= 2 {
+			// The primary and the hedge of the first attempt outlive the attempt timeout.
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		}
+
+		return respond(r, http.StatusOK, "ok"), nil
+	}}
+
+	var causes []error
+	resp, err := hedgedClient(transport, NewHedger(0.5, 5*time.Millisecond)).
+		WithAttemptTimeout(50 * time.Millisecond).
+		WithOnRetry(func(attempt int, delay time.Duration, err error) { causes = append(causes, err) }).
+		DoAndRead()
+	if err != nil {
+		t.Fatalf("DoAndRead: %v", err)
+	}
+	if string(resp.Body) != "ok" {
+		t.Fatalf("got body %q", resp.Body)
+	}
+	if len(causes) != 1 || !errors.Is(causes[0], context.DeadlineExceeded) {
+		t.Fatalf("got retry causes %v, want one attempt timeout", causes)
+	}
+}
+
+func TestHedgerDelay(t *testing.T) {
+	h := NewHedger(0.9, time.Second)
+	if got := h.Delay(); got != time.Second {
+		t.Fatalf("got delay %s without samples, want the fallback", got)
+	}
+
+	for i := 1; i <= hedgerMinSamples*2; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+	if got, want := h.Delay(), 28*time.Millisecond; got != want {
+		t.Fatalf("got delay %s, want %s", got, want)
+	}
+}
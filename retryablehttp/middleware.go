@@ -0,0 +1,35 @@
+package retryablehttp
+
+import (
+	"net/http"
+)
+
+// RoundTripFunc adapts a function to http.RoundTripper.
+type RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps the round trip of every attempt, e.g. to add authentication or tracing headers,
+// sign or log requests. Each attempt passes a fresh copy of the request, which a middleware may modify.
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// SetHeader returns a middleware setting a header on every request.
+func SetHeader(key, value string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			req.Header.Set(key, value)
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// chain wraps rt with middleware so that the first middleware is the outermost one.
+func chain(rt http.RoundTripper, middleware []Middleware) http.RoundTripper {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		rt = middleware[i](rt)
+	}
+
+	return rt
+}
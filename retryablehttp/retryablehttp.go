@@ -2,10 +2,14 @@ package retryablehttp
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/go-playground/validator/v10"
@@ -22,18 +26,38 @@ const (
 	MethodDelete Method = "DELETE"
 )
 
+// Client describes a retryable HTTP request. Clients are immutable once built: every With* and
+// AppendHeader call returns a modified copy and leaves the receiver untouched, so a configured
+// Client, including DefaultClient, can be shared and derived from by many goroutines.
 type Client struct {
-	Url            string                                    `validate:"required,http_url"`
-	Method         Method                                    `validate:"required"`
-	Body           []byte                                    `validate:"required"`
-	Header         map[string]string                         `validate:"required"`
-	HttpClient     *http.Client                              `validate:"required"`
-	context        context.Context                           `validate:"required"`
-	maxRetries     uint16                                    `validate:"required,gt=0,lte=65535"`
-	retryDelay     time.Duration                             `validate:"required"`
-	retryCondition func(resp *http.Response, err error) bool `validate:"required"`
+	Url            string            `validate:"required,http_url"`
+	Method         Method            `validate:"required"`
+	Body           []byte            `validate:"required"`
+	Header         map[string]string `validate:"required"`
+	HttpClient     *http.Client      `validate:"required"`
+	context        context.Context   `validate:"required"`
+	maxRetries     uint16            `validate:"required,gt=0,lte=65535"`
+	retryDelay     time.Duration     `validate:"required"`
+	retryCondition func(resp *http.Response, err error) bool
+	classifier     Classifier
+	onRetry        func(attempt int, delay time.Duration, cause error)
+	bodyValidator  func(body []byte) error
+	attemptTimeout time.Duration
+	hedger         *Hedger
+	breaker        *CircuitBreaker
+	middleware     []Middleware
 }
 
+// Response is a response whose body was fully read, and decompressed if needed, by DoAndRead.
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// maxDrainBytes bounds how much of a discarded response body is read so the connection can be reused.
+const maxDrainBytes = 64 << 10
+
 var DefaultClient = &Client{
 	Body:       make([]byte, 0),
 	Header:     make(map[string]string),
@@ -43,109 +67,375 @@ var DefaultClient = &Client{
 	retryDelay: 0,
 }
 
+// New returns an empty client; DefaultClient is the usual starting point for building one.
 func New() *Client {
 	return &Client{}
 }
 
 func (c *Client) WithUrl(url string) *Client {
-	c.Url = url
-	return c
+	cp := c.clone()
+	cp.Url = url
+	return cp
 }
 
 func (c *Client) WithMethod(method Method) *Client {
-	c.Method = method
-	return c
+	cp := c.clone()
+	cp.Method = method
+	return cp
 }
 
 func (c *Client) WithBody(body []byte) *Client {
-	c.Body = body
-	return c
+	cp := c.clone()
+	cp.Body = slices.Clone(body)
+	return cp
 }
 
 func (c *Client) WithHeader(header map[string]string) *Client {
-	c.Header = header
-	return c
+	cp := c.clone()
+	cp.Header = maps.Clone(header)
+	return cp
 }
 
 func (c *Client) AppendHeader(key, value string) *Client {
-	c.Header[key] = value
-	return c
+	cp := c.clone()
+	cp.Header[key] = value
+	return cp
+}
+
+// clone returns a copy of the client that shares no mutable state with the receiver.
+func (c *Client) clone() *Client {
+	cp := *c
+	cp.Header = maps.Clone(c.Header)
+	if cp.Header == nil {
+		cp.Header = make(map[string]string)
+	}
+	cp.Body = slices.Clone(c.Body)
+	cp.middleware = slices.Clone(c.middleware)
+
+	return &cp
 }
 
 func (c *Client) WithHttpClient(client *http.Client) *Client {
-	c.HttpClient = client
-	return c
+	cp := c.clone()
+	cp.HttpClient = client
+	return cp
 }
 
 func (c *Client) WithContext(ctx context.Context) *Client {
-	c.context = ctx
-	return c
+	cp := c.clone()
+	cp.context = ctx
+	return cp
 }
 
 func (c *Client) WithMaxRetries(maxRetries uint16) *Client {
-	c.maxRetries = maxRetries
-	return c
+	cp := c.clone()
+	cp.maxRetries = maxRetries
+	return cp
 }
 
 func (c *Client) WithRetryDelay(delay time.Duration) *Client {
-	c.retryDelay = delay
-	return c
+	cp := c.clone()
+	cp.retryDelay = delay
+	return cp
 }
 
 func (c *Client) WithRetryCondition(condition func(resp *http.Response, err error) bool) *Client {
-	c.retryCondition = condition
-	return c
+	cp := c.clone()
+	cp.retryCondition = condition
+	return cp
 }
 
-func (c *Client) retry(fn func() (*http.Response, error)) (*http.Response, error) {
-	var (
-		resp            = &http.Response{}
-		err      error  = nil
-		retry    bool   = false
-		retryErr string = ""
-	)
+// WithClassifier sets how attempts are classified; it takes precedence over WithRetryCondition.
+// Without either, DefaultClassifier is used.
+func (c *Client) WithClassifier(classifier Classifier) *Client {
+	cp := c.clone()
+	cp.classifier = classifier
+	return cp
+}
+
+// WithOnRetry sets a callback invoked before every retry with the number of the failed attempt,
+// the delay before the next one and the cause of the failure.
+func (c *Client) WithOnRetry(onRetry func(attempt int, delay time.Duration, cause error)) *Client {
+	cp := c.clone()
+	cp.onRetry = onRetry
+	return cp
+}
+
+// WithAttemptTimeout bounds every attempt, including reading the body in DoAndRead; zero disables the bound.
+// An attempt that times out is classified like any other network timeout.
+func (c *Client) WithAttemptTimeout(timeout time.Duration) *Client {
+	cp := c.clone()
+	cp.attemptTimeout = timeout
+	return cp
+}
+
+// WithHedger enables request hedging in DoAndRead using the delays computed by hedger.
+// The same Hedger should be shared by all clients issuing comparable requests so it learns their latency.
+func (c *Client) WithHedger(hedger *Hedger) *Client {
+	cp := c.clone()
+	cp.hedger = hedger
+	return cp
+}
+
+// WithCircuitBreaker guards every attempt with breaker. Attempts rejected by an open breaker fail the
+// request immediately with a RetryError wrapping ErrCircuitOpen; attempts classified as retryable count
+// as failures and any other outcome, including 4xx responses, proves the host is up and counts as a success.
+func (c *Client) WithCircuitBreaker(breaker *CircuitBreaker) *Client {
+	cp := c.clone()
+	cp.breaker = breaker
+	return cp
+}
+
+// WithMiddleware appends middleware around the round trip of every attempt; the first one added runs outermost.
+func (c *Client) WithMiddleware(middleware ...Middleware) *Client {
+	cp := c.clone()
+	cp.middleware = append(cp.middleware, middleware...)
+	return cp
+}
+
+// WithBodyValidator sets a check DoAndRead runs on every read body; an error fails the attempt and
+// makes it eligible for retry.
+func (c *Client) WithBodyValidator(validator func(body []byte) error) *Client {
+	cp := c.clone()
+	cp.bodyValidator = validator
+	return cp
+}
+
+// attemptResult is the outcome of a single attempt; body is only filled by DoAndRead attempts.
+type attemptResult struct {
+	resp *http.Response
+	body []byte
+	err  error
+}
+
+func (c *Client) retry(fn func(ctx context.Context) attemptResult) (attemptResult, error) {
+	classify := c.classify()
+	retryErr := &RetryError{}
 
 	for i := uint16(0); i < c.maxRetries+1; i += 1 {
 		if c.context.Err() != nil {
-			err := fmt.Errorf("retryable http call context closed; %v", c.context.Err())
-			return nil, err
+			return attemptResult{}, fmt.Errorf("retryable http call context closed; %w", c.context.Err())
+		}
+
+		var generation uint64
+		if c.breaker != nil {
+			allowed, err := c.breaker.allow()
+			if err != nil {
+				retryErr.record(nil, err, OutcomePermanent)
+				break
+			}
+			generation = allowed
 		}
 
-		if retry {
-			time.Sleep(c.retryDelay)
+		ctx, cancel := c.attemptContext()
+		result := fn(ctx)
+
+		outcome := classify(result.resp, result.err)
+		if c.breaker != nil {
+			// A cancelled attempt neither succeeded nor failed; it must not close a half-open breaker.
+			if errors.Is(result.err, context.Canceled) {
+				c.breaker.release(generation)
+			} else {
+				c.breaker.record(generation, outcome != OutcomeRetryable)
+			}
+		}
+		if result.err == nil && outcome == OutcomeSuccess {
+			// The attempt context must outlive the call so the caller can still read the body.
+			result.resp.Body = &cancelOnClose{ReadCloser: result.resp.Body, cancel: cancel}
+			return result, nil
 		}
 
-		resp, err = fn()
+		cause := result.err
+		if cause == nil {
+			cause = &StatusError{StatusCode: result.resp.StatusCode}
+		}
 
-		retry = c.retryCondition(resp, err)
+		retryErr.record(result.resp, cause, outcome)
+		discard(result.resp)
+		cancel()
 
-		if err == nil && !retry {
-			return resp, nil
+		if outcome != OutcomeRetryable || i == c.maxRetries {
+			break
 		}
 
-		retryErr += fmt.Sprintf("\n\t\ttry %d: %v; retry condition status: %v", i+1, err, retry)
+		if c.onRetry != nil {
+			c.onRetry(int(i)+1, c.retryDelay, cause)
+		}
+
+		if err := c.sleep(c.retryDelay); err != nil {
+			return attemptResult{}, fmt.Errorf("retryable http call context closed; %w", err)
+		}
 	}
 
-	return nil, fmt.Errorf("retryable http client max retries exceeded; %s", retryErr)
+	return attemptResult{}, retryErr
+}
+
+// attemptContext derives the context of a single attempt, bounded by the attempt timeout if one is set.
+func (c *Client) attemptContext() (context.Context, context.CancelFunc) {
+	if c.attemptTimeout > 0 {
+		return context.WithTimeout(c.context, c.attemptTimeout)
+	}
+
+	return context.WithCancel(c.context)
+}
+
+func (c *Client) classify() Classifier {
+	switch {
+	case c.classifier != nil:
+		return c.classifier
+	case c.retryCondition != nil:
+		return conditionClassifier(c.retryCondition)
+	default:
+		return DefaultClassifier
+	}
 }
 
+// sleep waits for delay unless the client context is closed first.
+func (c *Client) sleep(delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-c.context.Done():
+		return c.context.Err()
+	}
+}
+
+// Do performs the request and returns the first successful response; the caller must close its body.
 func (c *Client) Do() (*http.Response, error) {
-	if err := validator.New().Struct(c); err != nil {
-		return nil, fmt.Errorf("validate retryable http client fail; %s", err.Error())
+	req, err := c.newRequest()
+	if err != nil {
+		return nil, err
 	}
 
-	req, err := http.NewRequestWithContext(c.context, string(c.Method), c.Url, bytes.NewReader(c.Body))
+	result, err := c.retry(func(ctx context.Context) attemptResult {
+		resp, err := c.send(req.Clone(ctx))
+		return attemptResult{resp: resp, err: err}
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return c.retry(func() (*http.Response, error) {
-		req.Body = io.NopCloser(bytes.NewReader(c.Body))
+	return result.resp, nil
+}
 
-		for k, v := range c.Header {
-			req.Header.Set(k, v)
+// DoAndRead performs the request and reads the whole response body as part of each attempt.
+// Gzip encoded bodies are decompressed and the body validator, if any, is applied, so a connection
+// reset mid-body, a truncated stream or a body rejected by the validator are retried like request failures.
+// When a Hedger is set, each attempt may be raced against a duplicate request.
+func (c *Client) DoAndRead() (*Response, error) {
+	req, err := c.newRequest()
+	if err != nil {
+		return nil, err
+	}
+
+	classify := c.classify()
+	read := func(ctx context.Context) attemptResult {
+		resp, err := c.send(req.Clone(ctx))
+		if err != nil || classify(resp, nil) != OutcomeSuccess {
+			return attemptResult{resp: resp, err: err}
 		}
 
-		return c.HttpClient.Do(req)
+		body, err := readBody(resp)
+		if err != nil {
+			return attemptResult{resp: resp, err: err}
+		}
+
+		if c.bodyValidator != nil {
+			if err := c.bodyValidator(body); err != nil {
+				return attemptResult{resp: resp, err: fmt.Errorf("invalid response body; %w", err)}
+			}
+		}
+
+		return attemptResult{resp: resp, body: body}
+	}
+
+	result, err := c.retry(func(ctx context.Context) attemptResult {
+		if c.hedger == nil {
+			return read(ctx)
+		}
+
+		return c.hedge(ctx, read, classify)
 	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.resp.Body.Close()
+
+	return &Response{
+		StatusCode: result.resp.StatusCode,
+		Header:     result.resp.Header,
+		Body:       result.body,
+	}, nil
+}
+
+func (c *Client) newRequest() (*http.Request, error) {
+	if err := validator.New().Struct(c); err != nil {
+		return nil, fmt.Errorf("validate retryable http client fail; %s", err.Error())
+	}
+
+	return http.NewRequestWithContext(c.context, string(c.Method), c.Url, bytes.NewReader(c.Body))
+}
+
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	req.Body = io.NopCloser(bytes.NewReader(c.Body))
+
+	for k, v := range c.Header {
+		req.Header.Set(k, v)
+	}
+
+	if len(c.middleware) == 0 {
+		return c.HttpClient.Do(req)
+	}
+
+	return chain(RoundTripFunc(c.HttpClient.Do), c.middleware).RoundTrip(req)
+}
+
+// readBody reads the whole body of resp, decompressing it according to its Content-Encoding.
+func readBody(resp *http.Response) ([]byte, error) {
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error creating gzip reader; %w", err)
+		}
+		defer gz.Close()
+
+		reader = gz
+	}
+
+	body, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body; %w", err)
+	}
+
+	return body, nil
+}
+
+// discard drains a bounded part of the body of a response that will not be returned and closes it.
+func discard(resp *http.Response) {
+	if resp == nil || resp.Body == nil {
+		return
+	}
+
+	_, _ = io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+	_ = resp.Body.Close()
+}
+
+// cancelOnClose releases the attempt context of a returned response once its body is closed.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	defer b.cancel()
+
+	return b.ReadCloser.Close()
 }
@@ -0,0 +1,99 @@
+package retryablehttp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// throttleChunkBytes bounds a single throttled read so that large reads are paced smoothly.
+const throttleChunkBytes = 32 << 10
+
+// BandwidthLimiter caps the rate at which response bodies are read, across every request sharing it.
+// A BandwidthLimiter is safe for concurrent use.
+type BandwidthLimiter struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewBandwidthLimiter returns a limiter allowing bytesPerSecond bytes per second on average.
+func NewBandwidthLimiter(bytesPerSecond int64) *BandwidthLimiter {
+	return &BandwidthLimiter{
+		rate: float64(bytesPerSecond),
+		last: time.Now(),
+	}
+}
+
+// Rate returns the number of bytes per second the limiter allows.
+func (l *BandwidthLimiter) Rate() float64 {
+	return l.rate
+}
+
+// WaitN accounts for n bytes and blocks until the limiter allows them or ctx is done.
+func (l *BandwidthLimiter) WaitN(ctx context.Context, n int) error {
+	if l.rate <= 0 || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	// Unused budget is capped at one second worth of bytes so idle periods do not allow huge bursts.
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	deficit := -l.tokens
+	l.mu.Unlock()
+
+	if deficit <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(time.Duration(deficit / l.rate * float64(time.Second)))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Throttle returns a middleware reading every response body through limiter.
+func Throttle(limiter *BandwidthLimiter) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := next.RoundTrip(req)
+			if err != nil || resp.Body == nil {
+				return resp, err
+			}
+
+			resp.Body = &throttledBody{ReadCloser: resp.Body, limiter: limiter, ctx: req.Context()}
+			return resp, nil
+		})
+	}
+}
+
+type throttledBody struct {
+	io.ReadCloser
+	limiter *BandwidthLimiter
+	ctx     context.Context
+}
+
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > throttleChunkBytes {
+		p = p[:throttleChunkBytes]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	if werr := b.limiter.WaitN(b.ctx, n); werr != nil && err == nil {
+		err = werr
+	}
+
+	return n, err
+}
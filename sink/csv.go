@@ -0,0 +1,216 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/csvencoder"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+	"io"
+	"slices"
+)
+
+type CSVOptions struct {
+	// Separator is the field separator; zero means the one Locale expects.
+	Separator rune
+	// Locale sets the decimal and thousands separators of prices and volumes.
+	Locale csvencoder.Locale
+	// Timestamp is how the timestamp column is rendered.
+	Timestamp timestamp.Format
+	// Columns selects and orders the columns by their csv tag name, or "date" and "time" for a split
+	// timestamp; empty means every column in field order.
+	Columns []string
+	// Headers renames columns in the header row, keyed by csv tag name.
+	Headers map[string]string
+	// NoHeader omits the header row.
+	NoHeader bool
+	// Float is how prices and volumes are rendered.
+	Float csvencoder.FloatFormat
+	// Quoting selects which fields are quoted.
+	Quoting csvencoder.Quoting
+	// LineTerminator ends every row; empty means "\n".
+	LineTerminator string
+	// FileOptions apply to the files created by CreateCSV.
+	FileOptions
+}
+
+// CSVSink writes ticks as CSV rows following csvencoder.TickSchema, preceded by a header row.
+// Nothing is written for an empty download.
+type CSVSink struct {
+	writer *csvencoder.Writer[*tick.Tick]
+	file   *outputFile
+	seen   map[tickKey]bool
+	// timestamp is the format of the export, which appended ticks are matched in.
+	timestamp timestamp.Format
+	// bySymbol is false when the symbol is not exported, so appended ticks are matched by timestamp alone.
+	bySymbol bool
+}
+
+func NewCSV(w io.Writer, options CSVOptions) (*CSVSink, error) {
+	schema, err := csvSchema(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return newCSV(w, schema, options, false), nil
+}
+
+// CreateCSV returns a CSVSink writing to filePath. The file is written atomically: Close replaces
+// filePath with the complete output and Abort leaves it untouched. The file is compressed and
+// appended to as set by the FileOptions of options.
+func CreateCSV(filePath string, options CSVOptions) (*CSVSink, error) {
+	schema, err := csvSchema(options)
+	if err != nil {
+		return nil, err
+	}
+
+	var seen map[tickKey]bool
+	var appendTo func(r io.Reader) error
+	if options.Append {
+		if options.NoHeader {
+			return nil, fmt.Errorf("appending to %s requires a header row", filePath)
+		}
+
+		seen = make(map[tickKey]bool)
+		appendTo = func(r io.Reader) error {
+			return readCSVKeys(r, schema, options, seen)
+		}
+	}
+
+	f, appended, err := createFile(filePath, options.FileOptions, appendTo)
+	if err != nil {
+		return nil, err
+	}
+
+	s := newCSV(f, schema, options, appended)
+	s.file = f
+	s.seen = seen
+	s.timestamp = options.Timestamp
+	s.bySymbol = len(options.Columns) == 0 || slices.Contains(options.Columns, "symbol")
+
+	return s, nil
+}
+
+func csvSchema(options CSVOptions) (csvencoder.Schema[*tick.Tick], error) {
+	schema := csvencoder.TickSchema(options.Timestamp)
+	if len(options.Columns) > 0 {
+		selected, err := schema.Select(options.Columns...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to select columns: %w", err)
+		}
+		schema = selected
+	}
+
+	return schema.Rename(options.Headers), nil
+}
+
+func newCSV(w io.Writer, schema csvencoder.Schema[*tick.Tick], options CSVOptions, appended bool) *CSVSink {
+	writer := csvencoder.NewWriter(w, schema).
+		WithHeader(!options.NoHeader && !appended).
+		WithFloatFormat(options.Float).
+		WithLocale(options.Locale).
+		WithQuoting(options.Quoting).
+		WithSeparator(options.separator())
+	if options.LineTerminator != "" {
+		writer.WithLineTerminator(options.LineTerminator)
+	}
+
+	return &CSVSink{writer: writer}
+}
+
+func (o CSVOptions) separator() rune {
+	if o.Separator != 0 {
+		return o.Separator
+	}
+
+	return o.Locale.FieldSeparator()
+}
+
+// readCSVKeys records the ticks of an existing export in seen, after checking it has the columns of schema.
+func readCSVKeys(r io.Reader, schema csvencoder.Schema[*tick.Tick], options CSVOptions, seen map[tickKey]bool) error {
+	headers := make(map[string]string, len(options.Headers))
+	for name, header := range options.Headers {
+		headers[header] = name
+	}
+
+	decoder := csvencoder.NewDecoder(r).
+		WithDecompression(false).
+		WithSeparator(options.separator()).
+		WithTimestampFormat(options.Timestamp).
+		WithLocale(options.Locale).
+		WithHeaders(headers)
+
+	header, err := decoder.Header()
+	if errors.Is(err, io.EOF) {
+		// A compressed export of an empty download holds no rows, not even a header.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !slices.Equal(header, schema.Headers()) {
+		return fmt.Errorf("columns %v do not match the export columns %v", header, schema.Headers())
+	}
+
+	for t, err := range decoder.All() {
+		if err != nil {
+			return err
+		}
+		seen[tickKey{symbol: t.Symbol, timestamp: t.Timestamp}] = true
+	}
+
+	return nil
+}
+
+func (s *CSVSink) Write(t *tick.Tick) error {
+	if s.seen != nil {
+		nanos, err := s.timestamp.Round(t.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		key := tickKey{timestamp: nanos}
+		if s.bySymbol {
+			key.symbol = t.Symbol
+		}
+
+		if s.seen[key] {
+			return nil
+		}
+	}
+
+	return s.writer.WriteRow(t)
+}
+
+func (s *CSVSink) Close() error {
+	err := s.writer.Flush()
+	if s.file == nil {
+		return err
+	}
+
+	if err != nil {
+		s.file.Abort()
+		return err
+	}
+
+	return s.file.Commit()
+}
+
+// Abort discards the output of a sink created by CreateCSV.
+func (s *CSVSink) Abort() error {
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Abort()
+}
+
+func (s *CSVSink) size() int64 {
+	size := int64(s.writer.Buffered())
+	if s.file != nil {
+		size += s.file.written
+	}
+
+	return size
+}
@@ -0,0 +1,231 @@
+package sink
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/compression"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Aborter is implemented by sinks that can discard their output instead of committing it.
+type Aborter interface {
+	Abort() error
+}
+
+// Abort discards the output of s if it supports it, leaving any file it replaces or appends to
+// untouched, and closes s otherwise.
+func Abort(s Sink) error {
+	if a, ok := s.(Aborter); ok {
+		return a.Abort()
+	}
+
+	return s.Close()
+}
+
+// tickKey identifies a tick when appending to a file.
+type tickKey struct {
+	symbol    string
+	timestamp int64
+}
+
+// atomicFile writes to a temporary file next to path, which Commit syncs and renames over path.
+// Readers of path see either its previous content or the complete new one, never a partial write.
+type atomicFile struct {
+	file *os.File
+	path string
+	// mode is the permissions of the file replaced, or 0o644 for a new one.
+	mode    fs.FileMode
+	written int64
+}
+
+// FileOptions configures how file sinks write their files.
+type FileOptions struct {
+	// Compression is the codec files are compressed with; compression.Auto selects it from the
+	// file extension, .gz or .zst.
+	Compression compression.Codec
+	// CompressionLevel is the codec level; zero means its default.
+	CompressionLevel int
+	// Append extends an existing file written with the same options instead of replacing it,
+	// skipping the ticks it already holds, by symbol and timestamp.
+	Append bool
+}
+
+// outputFile is an atomicFile written through the compressor selected by FileOptions.
+type outputFile struct {
+	*atomicFile
+	compressor io.WriteCloser
+}
+
+// createFile starts writing path. With Append set and data in path, that data is first passed,
+// decompressed, to appendTo and then copied to the new file, and appended is true.
+func createFile(path string, options FileOptions, appendTo func(r io.Reader) error) (f *outputFile, appended bool, err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to open file %s: %w", path, err)
+	}
+
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	codec := options.Compression.Resolve(path)
+	atomic := &atomicFile{file: tmp, path: path, mode: mode}
+	newline := false
+	if options.Append {
+		appended, newline, err = atomic.copyExisting(codec, appendTo)
+		if err != nil {
+			atomic.Abort()
+			return nil, false, err
+		}
+	}
+
+	// Compressed streams concatenate, so appending starts a new stream after the existing ones.
+	compressor, err := compression.NewWriter(atomic, codec, options.CompressionLevel)
+	if err != nil {
+		atomic.Abort()
+		return nil, false, err
+	}
+
+	f = &outputFile{atomicFile: atomic, compressor: compressor}
+	if newline {
+		if _, err := f.Write([]byte{'\n'}); err != nil {
+			f.Abort()
+			return nil, false, err
+		}
+	}
+
+	return f, appended, nil
+}
+
+func (f *outputFile) Write(p []byte) (int, error) {
+	return f.compressor.Write(p)
+}
+
+// Commit ends the compressed stream and commits the file.
+func (f *outputFile) Commit() error {
+	if err := f.compressor.Close(); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to write file %s: %w", f.path, err)
+	}
+
+	return f.atomicFile.Commit()
+}
+
+// copyExisting passes the decompressed content of the existing file to appendTo and copies the file as is.
+// The existing file must be compressed with codec, which the appended data is written with.
+// newline reports whether its content does not end with a line break, which must be added before appending.
+func (f *atomicFile) copyExisting(codec compression.Codec, appendTo func(r io.Reader) error) (appended bool, newline bool, err error) {
+	existing, err := os.Open(f.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to open file %s: %w", f.path, err)
+	}
+	defer existing.Close()
+
+	info, err := existing.Stat()
+	if err != nil {
+		return false, false, fmt.Errorf("failed to open file %s: %w", f.path, err)
+	}
+	if info.Size() == 0 {
+		return false, false, nil
+	}
+
+	magic := make([]byte, 4)
+	n, err := existing.ReadAt(magic, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return false, false, fmt.Errorf("failed to read file %s: %w", f.path, err)
+	}
+	if existing := compression.Detect(magic[:n]); existing != codec {
+		return false, false, fmt.Errorf("cannot append %s data to file %s compressed with %s", codec, f.path, existing)
+	}
+
+	content := &lastByteReader{r: compression.NewReader(existing)}
+	defer content.r.(io.Closer).Close()
+
+	if err := appendTo(bufio.NewReader(content)); err != nil {
+		return false, false, fmt.Errorf("failed to read file %s: %w", f.path, err)
+	}
+
+	// Readers may stop before the end, which the last byte must be taken from.
+	if _, err := io.Copy(io.Discard, content); err != nil {
+		return false, false, fmt.Errorf("failed to read file %s: %w", f.path, err)
+	}
+
+	if _, err := existing.Seek(0, io.SeekStart); err != nil {
+		return false, false, fmt.Errorf("failed to read file %s: %w", f.path, err)
+	}
+
+	if _, err := io.Copy(f, existing); err != nil {
+		return false, false, fmt.Errorf("failed to copy file %s: %w", f.path, err)
+	}
+
+	// A file cut short after its last row must not glue that row to the first appended one.
+	return content.n > 0, content.n > 0 && content.last != '\n', nil
+}
+
+// lastByteReader remembers the last byte read through it.
+type lastByteReader struct {
+	r    io.Reader
+	n    int64
+	last byte
+}
+
+func (r *lastByteReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if n > 0 {
+		r.n += int64(n)
+		r.last = p[n-1]
+	}
+
+	return n, err
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	n, err := f.file.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+// Commit makes the written data durable and moves it to path.
+func (f *atomicFile) Commit() error {
+	if err := f.file.Sync(); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to sync file %s: %w", f.path, err)
+	}
+
+	if err := f.file.Chmod(f.mode); err != nil {
+		f.Abort()
+		return fmt.Errorf("failed to write file %s: %w", f.path, err)
+	}
+
+	if err := f.file.Close(); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("failed to write file %s: %w", f.path, err)
+	}
+
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("failed to rename file %s: %w", f.path, err)
+	}
+
+	// Persist the rename itself; not every platform can sync a directory, so failures are ignored.
+	if dir, err := os.Open(filepath.Dir(f.path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+// Abort discards the written data, leaving path untouched.
+func (f *atomicFile) Abort() error {
+	f.file.Close()
+	return os.Remove(f.file.Name())
+}
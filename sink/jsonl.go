@@ -0,0 +1,345 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/compression"
+	"github.com/condrove10/dukascopy-downloader/conversions"
+	"github.com/condrove10/dukascopy-downloader/cursor"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+	"io"
+	"iter"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+)
+
+type JSONLOptions struct {
+	// Timestamp is how the timestamp field is rendered.
+	Timestamp timestamp.Format
+	// FileOptions apply to the files created by CreateJSONL.
+	FileOptions
+}
+
+// jsonField appends the value of one key of a tick object.
+type jsonField struct {
+	key    string
+	append func(dst []byte, t *tick.Tick) ([]byte, error)
+}
+
+// JSONLSink writes one JSON object per tick and line, keyed by the json tags of tick.Tick in
+// alphabetical order. Objects are built from a conversions.FieldPlan, without a map per tick.
+type JSONLSink struct {
+	buffer *bufio.Writer
+	file   *outputFile
+	seen   map[tickKey]bool
+	// timestamp is the format of the export, which appended ticks are matched in.
+	timestamp timestamp.Format
+	fields    []jsonField
+	line      []byte
+}
+
+func NewJSONL(w io.Writer, options JSONLOptions) *JSONLSink {
+	return &JSONLSink{
+		buffer: bufio.NewWriter(w),
+		fields: jsonFields(options.Timestamp),
+	}
+}
+
+// CreateJSONL returns a JSONLSink writing to filePath. The file is written atomically: Close replaces
+// filePath with the complete output and Abort leaves it untouched. The file is compressed and
+// appended to as set by the FileOptions of options.
+func CreateJSONL(filePath string, options JSONLOptions) (*JSONLSink, error) {
+	var seen map[tickKey]bool
+	var appendTo func(r io.Reader) error
+	if options.Append {
+		seen = make(map[tickKey]bool)
+		appendTo = func(r io.Reader) error {
+			return readJSONLKeys(r, options, seen)
+		}
+	}
+
+	f, _, err := createFile(filePath, options.FileOptions, appendTo)
+	if err != nil {
+		return nil, err
+	}
+
+	s := NewJSONL(f, options)
+	s.file = f
+	s.seen = seen
+	s.timestamp = options.Timestamp
+
+	return s, nil
+}
+
+// readJSONLKeys records the ticks of an existing export in seen.
+func readJSONLKeys(r io.Reader, options JSONLOptions, seen map[tickKey]bool) error {
+	decoder := NewJSONLDecoder(r).
+		WithDecompression(false).
+		WithTimestampFormat(options.Timestamp)
+
+	for t, err := range decoder.All() {
+		if err != nil {
+			return err
+		}
+		seen[tickKey{symbol: t.Symbol, timestamp: t.Timestamp}] = true
+	}
+
+	return nil
+}
+
+// JSONLDecoder reads ticks back from JSON lines, such as the files written by JSONLSink.
+// Keys are matched to tick.Tick fields by their json tag; unknown keys are ignored.
+type JSONLDecoder struct {
+	source     io.Reader
+	decompress bool
+	timestamp  timestamp.Format
+
+	decoder *json.Decoder
+	line    int
+}
+
+// NewJSONLDecoder returns a JSONLDecoder reading Unix nanosecond timestamps.
+// Gzip and zstd compressed input is decompressed transparently.
+func NewJSONLDecoder(r io.Reader) *JSONLDecoder {
+	return &JSONLDecoder{
+		source:     r,
+		decompress: true,
+	}
+}
+
+// WithDecompression sets whether compressed input is detected and decompressed; disable it for
+// input that was already decompressed.
+func (d *JSONLDecoder) WithDecompression(decompress bool) *JSONLDecoder {
+	d.decompress = decompress
+	return d
+}
+
+// WithTimestampFormat sets how the timestamp key, or the date and time keys, are read.
+func (d *JSONLDecoder) WithTimestampFormat(format timestamp.Format) *JSONLDecoder {
+	d.timestamp = format
+	return d
+}
+
+// Decode reads the next tick. It returns io.EOF once the input is exhausted.
+func (d *JSONLDecoder) Decode() (*tick.Tick, error) {
+	if d.decoder == nil {
+		source := d.source
+		if d.decompress {
+			source = compression.NewReader(source)
+		}
+
+		d.decoder = json.NewDecoder(source)
+		d.decoder.UseNumber()
+	}
+
+	var object map[string]interface{}
+	if err := d.decoder.Decode(&object); err == io.EOF {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to decode line %d: %w", d.line+1, err)
+	}
+	d.line++
+
+	columns := d.timestamp.Columns(timestampKey)
+	values := make([]string, len(columns))
+	for i, column := range columns {
+		value, ok := object[column]
+		if !ok {
+			return nil, fmt.Errorf("failed to decode line %d: missing key %q", d.line, column)
+		}
+		values[i] = fmt.Sprint(value)
+	}
+
+	nanos, err := d.timestamp.Parse(values)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode line %d: %w", d.line, err)
+	}
+	object[timestampKey] = nanos
+
+	t := tick.New()
+	if err := conversions.MapToStruct(object, t, "json"); err != nil {
+		return nil, fmt.Errorf("failed to decode line %d: %w", d.line, err)
+	}
+
+	return t, nil
+}
+
+// All returns an iterator over the remaining ticks; a decoding failure is yielded as the last element.
+func (d *JSONLDecoder) All() iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		for {
+			t, err := d.Decode()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+
+			if !yield(t, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Cursor returns a cursor over the remaining ticks, so decoded files can stand in for a download.
+func (d *JSONLDecoder) Cursor(bufferSize int) *cursor.Cursor {
+	return cursor.FromSeq(d.All(), bufferSize)
+}
+
+func (s *JSONLSink) Write(t *tick.Tick) error {
+	if s.seen != nil {
+		nanos, err := s.timestamp.Round(t.Timestamp)
+		if err != nil {
+			return err
+		}
+
+		if s.seen[tickKey{symbol: t.Symbol, timestamp: nanos}] {
+			return nil
+		}
+	}
+
+	var err error
+
+	s.line = append(s.line[:0], '{')
+	for i, f := range s.fields {
+		if i > 0 {
+			s.line = append(s.line, ',')
+		}
+		s.line = append(s.line, f.key...)
+
+		s.line, err = f.append(s.line, t)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", f.key, err)
+		}
+	}
+	s.line = append(s.line, '}', '\n')
+
+	_, err = s.buffer.Write(s.line)
+	return err
+}
+
+func (s *JSONLSink) Close() error {
+	err := s.buffer.Flush()
+	if s.file == nil {
+		return err
+	}
+
+	if err != nil {
+		s.file.Abort()
+		return err
+	}
+
+	return s.file.Commit()
+}
+
+// Abort discards the output of a sink created by CreateJSONL.
+func (s *JSONLSink) Abort() error {
+	if s.file == nil {
+		return nil
+	}
+
+	return s.file.Abort()
+}
+
+func (s *JSONLSink) size() int64 {
+	size := int64(s.buffer.Buffered())
+	if s.file != nil {
+		size += s.file.written
+	}
+
+	return size
+}
+
+// jsonFields returns the fields of a tick object sorted by key, with the timestamp rendered by ts.
+func jsonFields(ts timestamp.Format) []jsonField {
+	plan, err := conversions.PlanFor[tick.Tick]("json")
+	if err != nil {
+		panic(err)
+	}
+
+	var fields []jsonField
+	for _, f := range plan.Fields {
+		if f.Name == timestampKey {
+			for i, name := range ts.Columns(f.Name) {
+				fields = append(fields, jsonField{key: jsonKey(name), append: func(dst []byte, t *tick.Tick) ([]byte, error) {
+					if unix, ok := ts.Unix(t.Timestamp); ok {
+						return strconv.AppendInt(dst, unix, 10), nil
+					}
+					return appendJSONValue(dst, ts.Values(t.Timestamp)[i])
+				}})
+			}
+			continue
+		}
+
+		var appendField func(dst []byte, t *tick.Tick) ([]byte, error)
+		switch f.Kind {
+		case reflect.String:
+			appendField = func(dst []byte, t *tick.Tick) ([]byte, error) { return appendJSONString(dst, f.String(t)), nil }
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			appendField = func(dst []byte, t *tick.Tick) ([]byte, error) { return strconv.AppendInt(dst, f.Int(t), 10), nil }
+		case reflect.Float32, reflect.Float64:
+			appendField = func(dst []byte, t *tick.Tick) ([]byte, error) { return appendJSONFloat(dst, f.Float(t)) }
+		default:
+			appendField = func(dst []byte, t *tick.Tick) ([]byte, error) { return appendJSONValue(dst, f.Value(t)) }
+		}
+		fields = append(fields, jsonField{key: jsonKey(f.Name), append: appendField})
+	}
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].key < fields[j].key })
+
+	return fields
+}
+
+func jsonKey(name string) string {
+	return string(appendJSONString(nil, name)) + ":"
+}
+
+// appendJSONFloat appends f formatted like encoding/json does.
+func appendJSONFloat(dst []byte, f float64) ([]byte, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return dst, fmt.Errorf("unsupported value %v", f)
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+
+	dst = strconv.AppendFloat(dst, f, format, -1, 64)
+	if format == 'e' {
+		// Shorten e-09 to e-9 like encoding/json.
+		n := len(dst)
+		if n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+
+	return dst, nil
+}
+
+func appendJSONString(dst []byte, s string) []byte {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < 0x20 || c > 0x7e || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			b, _ := json.Marshal(s)
+			return append(dst, b...)
+		}
+	}
+
+	dst = append(dst, '"')
+	dst = append(dst, s...)
+	return append(dst, '"')
+}
+
+func appendJSONValue(dst []byte, v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return dst, err
+	}
+
+	return append(dst, b...), nil
+}
@@ -0,0 +1,99 @@
+package sink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/condrove10/dukascopy-downloader/compression"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"github.com/condrove10/dukascopy-downloader/timestamp"
+)
+
+func jsonlTicks() []*tick.Tick {
+	start := time.Date(2024, 3, 10, 14, 30, 0, 0, time.UTC)
+	return []*tick.Tick{
+		{Symbol: "EURUSD", Timestamp: start.Add(123 * time.Millisecond).UnixNano(), Ask: 1.08123, Bid: 1.08119, VolumeAsk: 1.25, VolumeBid: 0.5},
+		{Symbol: "GBPUSD", Timestamp: start.Add(time.Hour + 7*time.Millisecond).UnixNano(), Ask: 1.2701, Bid: 1.26995, VolumeAsk: 0.0000001, VolumeBid: 12.75},
+	}
+}
+
+func TestJSONLDecoderRoundTrip(t *testing.T) {
+	formats := []timestamp.Format{
+		{Kind: timestamp.UnixNanos},
+		{Kind: timestamp.UnixMillis},
+		{Kind: timestamp.RFC3339, Precision: -1},
+		{Kind: timestamp.Split, Precision: 3},
+	}
+
+	for _, format := range formats {
+		for _, codec := range []compression.Codec{compression.None, compression.Gzip, compression.Zstd} {
+			t.Run(string(format.Kind)+"/"+string(codec), func(t *testing.T) {
+				var buf bytes.Buffer
+				w, err := compression.NewWriter(&buf, codec, 0)
+				if err != nil {
+					t.Fatalf("NewWriter: %v", err)
+				}
+
+				s := NewJSONL(w, JSONLOptions{Timestamp: format})
+				for _, tk := range jsonlTicks() {
+					if err := s.Write(tk); err != nil {
+						t.Fatalf("Write: %v", err)
+					}
+				}
+				if err := s.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close: %v", err)
+				}
+
+				var got []*tick.Tick
+				for tk, err := range NewJSONLDecoder(&buf).WithTimestampFormat(format).Cursor(1).All(context.Background()) {
+					if err != nil {
+						t.Fatalf("decode: %v", err)
+					}
+					got = append(got, tk)
+				}
+
+				want := jsonlTicks()
+				for _, tk := range want {
+					if tk.Timestamp, err = format.Round(tk.Timestamp); err != nil {
+						t.Fatalf("Round: %v", err)
+					}
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Fatalf("got %+v, want %+v", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestJSONLDecoderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "invalid json", input: `{"symbol":`},
+		{name: "missing timestamp", input: `{"symbol":"EURUSD","ask":1}`},
+		{name: "invalid price", input: `{"timestamp":1,"ask":"one"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJSONLDecoder(strings.NewReader(tt.input)).Decode()
+			if err == nil || err == io.EOF {
+				t.Fatalf("got %v, want a decoding error", err)
+			}
+		})
+	}
+
+	if _, err := NewJSONLDecoder(strings.NewReader("")).Decode(); err != io.EOF {
+		t.Fatalf("empty input: got %v, want io.EOF", err)
+	}
+}
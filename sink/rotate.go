@@ -0,0 +1,233 @@
+package sink
+
+import (
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Period is the time period a RotatingSink keeps in one file.
+type Period string
+
+const (
+	PeriodNone  Period = ""
+	PeriodHour  Period = "hour"
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+	PeriodYear  Period = "year"
+)
+
+// ParsePeriod parses a period name as accepted on the command line.
+func ParsePeriod(value string) (Period, error) {
+	switch p := Period(value); p {
+	case PeriodNone, PeriodHour, PeriodDay, PeriodMonth, PeriodYear:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown period %q, want hour, day, month or year", value)
+	}
+}
+
+// key returns a value identifying the period t falls in.
+func (p Period) key(t time.Time) string {
+	switch p {
+	case PeriodHour:
+		return t.Format("2006010215")
+	case PeriodDay:
+		return t.Format("20060102")
+	case PeriodMonth:
+		return t.Format("200601")
+	case PeriodYear:
+		return t.Format("2006")
+	default:
+		return ""
+	}
+}
+
+// templatePeriod returns the period of the finest date placeholder in template, or PeriodNone without one.
+func templatePeriod(template string) Period {
+	switch {
+	case strings.Contains(template, "{hh}"):
+		return PeriodHour
+	case strings.Contains(template, "{dd}"):
+		return PeriodDay
+	case strings.Contains(template, "{mm}"):
+		return PeriodMonth
+	case strings.Contains(template, "{yyyy}"):
+		return PeriodYear
+	default:
+		return PeriodNone
+	}
+}
+
+type RotateOptions struct {
+	// Period starts a new file for every period, in Location, the ticks fall in. PeriodNone rotates on the
+	// finest date placeholder of the template, if any, so every file holds the dates its name shows.
+	Period Period
+	// MaxTicks starts a new file once a file holds that many ticks; zero means no limit.
+	MaxTicks int64
+	// MaxBytes starts a new file once a file holds that many bytes, exceeding it by up to one tick;
+	// zero means no limit. It requires the files to be created by CreateCSV or CreateJSONL. For
+	// compressed files the limit is approximate: data held by the compressor is not counted, so
+	// files may exceed it by up to the compressor's buffer.
+	MaxBytes int64
+	// Location is the timezone of periods and of the dates in file names; nil means UTC.
+	Location *time.Location
+}
+
+// RotatingSink writes ticks to a sequence of files named after a template, creating directories as needed.
+// Each file is created by a function such as CreateCSV, so files are committed as they are completed.
+// The template may hold the placeholders {symbol}, {yyyy}, {mm}, {dd} and {hh}, replaced by the symbol and
+// the date of the first tick of the file, and {seq}, the index of the file among those sharing a name
+// otherwise. When a name repeats without {seq} in the template, "_<seq>" is inserted before its extensions.
+// A new file is started whenever the symbol or period changes or a size limit is reached.
+type RotatingSink struct {
+	template string
+	options  RotateOptions
+	create   func(path string) (Sink, error)
+
+	sink   Sink
+	symbol string
+	period string
+	ticks  int64
+	base   string
+	seq    int
+	paths  []string
+}
+
+// NewRotating returns a RotatingSink writing every file through the sink create returns for its path.
+func NewRotating(template string, options RotateOptions, create func(path string) (Sink, error)) *RotatingSink {
+	if options.Period == PeriodNone {
+		options.Period = templatePeriod(template)
+	}
+
+	return &RotatingSink{
+		template: template,
+		options:  options,
+		create:   create,
+	}
+}
+
+// Paths returns the paths of the files written so far, in order.
+func (s *RotatingSink) Paths() []string {
+	return s.paths
+}
+
+func (s *RotatingSink) Write(t *tick.Tick) error {
+	when := time.Unix(0, t.Timestamp).In(s.location())
+	period := s.options.Period.key(when)
+
+	if s.sink == nil || t.Symbol != s.symbol || period != s.period ||
+		(s.options.MaxTicks > 0 && s.ticks >= s.options.MaxTicks) ||
+		(s.options.MaxBytes > 0 && s.size() >= s.options.MaxBytes) {
+		if err := s.rotate(t.Symbol, period, when); err != nil {
+			return err
+		}
+	}
+
+	s.ticks++
+	return s.sink.Write(t)
+}
+
+func (s *RotatingSink) Close() error {
+	if s.sink == nil {
+		return nil
+	}
+
+	err := s.sink.Close()
+	s.sink = nil
+
+	return err
+}
+
+// Abort discards the current file; the files completed before are kept.
+func (s *RotatingSink) Abort() error {
+	if s.sink == nil {
+		return nil
+	}
+
+	err := Abort(s.sink)
+	s.sink = nil
+
+	return err
+}
+
+func (s *RotatingSink) rotate(symbol string, period string, when time.Time) error {
+	if err := s.Close(); err != nil {
+		return err
+	}
+
+	base := s.render(symbol, when)
+	if base == s.base {
+		s.seq++
+	} else {
+		s.base = base
+		s.seq = 0
+	}
+
+	path := s.path()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+
+	sink, err := s.create(path)
+	if err != nil {
+		return err
+	}
+
+	s.sink = sink
+	s.symbol, s.period, s.ticks = symbol, period, 0
+	s.paths = append(s.paths, path)
+
+	return nil
+}
+
+// size returns the number of bytes written to the current file.
+func (s *RotatingSink) size() int64 {
+	if sz, ok := s.sink.(sizer); ok {
+		return sz.size()
+	}
+
+	return 0
+}
+
+// render replaces the placeholders of the template other than {seq}.
+func (s *RotatingSink) render(symbol string, when time.Time) string {
+	return strings.NewReplacer(
+		"{symbol}", symbol,
+		"{yyyy}", when.Format("2006"),
+		"{mm}", when.Format("01"),
+		"{dd}", when.Format("02"),
+		"{hh}", when.Format("15"),
+	).Replace(s.template)
+}
+
+// path returns the name of the current file from its rendered base and sequence number.
+func (s *RotatingSink) path() string {
+	if strings.Contains(s.base, "{seq}") {
+		return strings.ReplaceAll(s.base, "{seq}", strconv.Itoa(s.seq))
+	}
+
+	if s.seq == 0 {
+		return s.base
+	}
+
+	dir, name := filepath.Split(s.base)
+	stem, extensions, _ := strings.Cut(name, ".")
+	if extensions != "" {
+		extensions = "." + extensions
+	}
+
+	return dir + stem + "_" + strconv.Itoa(s.seq) + extensions
+}
+
+func (s *RotatingSink) location() *time.Location {
+	if s.options.Location == nil {
+		return time.UTC
+	}
+
+	return s.options.Location
+}
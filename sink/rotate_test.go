@@ -0,0 +1,75 @@
+package sink
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/condrove10/dukascopy-downloader/tick"
+)
+
+// countingSink counts the ticks written to the file at path.
+type countingSink struct {
+	counts map[string]int
+	path   string
+}
+
+func (s countingSink) Write(*tick.Tick) error {
+	s.counts[s.path]++
+	return nil
+}
+
+func (s countingSink) Close() error {
+	return nil
+}
+
+func TestRotatingPeriodFromTemplate(t *testing.T) {
+	start := time.Date(2024, 1, 31, 22, 0, 0, 0, time.UTC)
+	var ticks []*tick.Tick
+	for h := 0; h < 4; h++ {
+		ticks = append(ticks, &tick.Tick{Symbol: "EURUSD", Timestamp: start.Add(time.Duration(h) * time.Hour).UnixNano()})
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		period   Period
+		want     map[string]int
+	}{
+		{name: "no placeholder", template: "{symbol}.csv", want: map[string]int{"EURUSD.csv": 4}},
+		{name: "day placeholder", template: "{symbol}_{yyyy}{mm}{dd}.csv", want: map[string]int{"EURUSD_20240131.csv": 2, "EURUSD_20240201.csv": 2}},
+		{name: "month placeholder", template: "{yyyy}/{mm}.csv", want: map[string]int{"2024/01.csv": 2, "2024/02.csv": 2}},
+		{name: "year placeholder", template: "{yyyy}.csv", want: map[string]int{"2024.csv": 4}},
+		{name: "hour placeholder", template: "{dd}/{hh}.csv", want: map[string]int{"31/22.csv": 1, "31/23.csv": 1, "01/00.csv": 1, "01/01.csv": 1}},
+		{name: "explicit period", template: "{yyyy}{mm}{dd}.csv", period: PeriodHour,
+			want: map[string]int{"20240131.csv": 1, "20240131_1.csv": 1, "20240201.csv": 1, "20240201_1.csv": 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			got := make(map[string]int)
+			s := NewRotating(filepath.Join(dir, tt.template), RotateOptions{Period: tt.period}, func(path string) (Sink, error) {
+				rel, err := filepath.Rel(dir, path)
+				if err != nil {
+					return nil, err
+				}
+				return countingSink{counts: got, path: filepath.ToSlash(rel)}, nil
+			})
+
+			for _, tk := range ticks {
+				if err := s.Write(tk); err != nil {
+					t.Fatalf("Write: %v", err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatalf("Close: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got ticks per file %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package sink
+
+import "github.com/condrove10/dukascopy-downloader/tick"
+
+// Sink receives the ticks of a download, in order. Close flushes buffered output and
+// releases the underlying resources; a Sink must not be written to after Close.
+type Sink interface {
+	Write(t *tick.Tick) error
+	Close() error
+}
+
+// timestampKey is the tag name of the tick field rendered with a timestamp.Format.
+const timestampKey = "timestamp"
+
+// sizer is implemented by the file sinks of this package to report the size of their output so far.
+type sizer interface {
+	size() int64
+}
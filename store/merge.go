@@ -0,0 +1,57 @@
+package store
+
+import (
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"iter"
+)
+
+// merge yields the ticks of sources, each ordered by timestamp, as one sequence ordered by timestamp.
+// Ties go to the earliest source. The first error of any source ends the sequence.
+func merge(sources []iter.Seq2[*tick.Tick, error]) iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		nexts := make([]func() (*tick.Tick, error, bool), len(sources))
+		heads := make([]*tick.Tick, len(sources))
+		for i, source := range sources {
+			next, stop := iter.Pull2(source)
+			defer stop()
+			nexts[i] = next
+		}
+
+		advance := func(i int) bool {
+			t, err, ok := nexts[i]()
+			if err != nil {
+				yield(nil, err)
+				return false
+			}
+
+			heads[i] = nil
+			if ok {
+				heads[i] = t
+			}
+			return true
+		}
+
+		for i := range sources {
+			if !advance(i) {
+				return
+			}
+		}
+
+		for {
+			first := -1
+			for i, t := range heads {
+				if t != nil && (first < 0 || t.Timestamp < heads[first].Timestamp) {
+					first = i
+				}
+			}
+
+			if first < 0 {
+				return
+			}
+
+			if !yield(heads[first], nil) || !advance(first) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package store
+
+import (
+	"errors"
+	"iter"
+	"testing"
+
+	"github.com/condrove10/dukascopy-downloader/tick"
+)
+
+func source(symbol string, timestamps ...int64) iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		for _, ts := range timestamps {
+			if !yield(tick.New().WithSymbol(symbol).WithTimestamp(ts), nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestMergeOrdersTiesBySource(t *testing.T) {
+	sources := []iter.Seq2[*tick.Tick, error]{
+		source("A", 1, 3, 3, 5),
+		source("B", 1, 2, 3),
+		source("C"),
+		source("D", 3, 6),
+	}
+
+	type key struct {
+		symbol    string
+		timestamp int64
+	}
+	want := []key{{"A", 1}, {"B", 1}, {"B", 2}, {"A", 3}, {"A", 3}, {"B", 3}, {"D", 3}, {"A", 5}, {"D", 6}}
+
+	var got []key
+	for tk, err := range merge(sources) {
+		if err != nil {
+			t.Fatalf("merge: %v", err)
+		}
+		got = append(got, key{tk.Symbol, tk.Timestamp})
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+func TestMergeStopsAtError(t *testing.T) {
+	errSource := errors.New("source failed")
+	failing := func(yield func(*tick.Tick, error) bool) {
+		if yield(tick.New().WithSymbol("B").WithTimestamp(2), nil) {
+			yield(nil, errSource)
+		}
+	}
+
+	var n int
+	var last error
+	for _, err := range merge([]iter.Seq2[*tick.Tick, error]{source("A", 1, 3, 4), failing}) {
+		if err != nil {
+			last = err
+			break
+		}
+		n++
+	}
+
+	if !errors.Is(last, errSource) {
+		t.Fatalf("got error %v, want %v", last, errSource)
+	}
+	if n != 2 {
+		t.Fatalf("got %d ticks before the error, want 2", n)
+	}
+}
@@ -0,0 +1,266 @@
+package store
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/condrove10/dukascopy-downloader/compression"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"io"
+	"math"
+)
+
+// Partitions hold the ticks of one symbol and day, column by column: timestamps and, for every price and
+// volume, either the deltas of the values scaled to the fewest decimal digits that represent them exactly,
+// or the XOR of the bits of consecutive values when no scale does. Integers are zigzag varints and the
+// whole partition is zstd compressed.
+
+var partitionMagic = [4]byte{'D', 'K', 'T', 'S'}
+
+const (
+	partitionVersion = 1
+	// rawFloats is the scale byte of a float column stored as XORed bits.
+	rawFloats  = 0xff
+	maxDecimal = 9
+)
+
+// floatColumns lists the float fields of a tick in storage order.
+var floatColumns = []struct {
+	get func(t *tick.Tick) float64
+	set func(t *tick.Tick, v float64)
+}{
+	{func(t *tick.Tick) float64 { return t.Ask }, func(t *tick.Tick, v float64) { t.Ask = v }},
+	{func(t *tick.Tick) float64 { return t.Bid }, func(t *tick.Tick, v float64) { t.Bid = v }},
+	{func(t *tick.Tick) float64 { return t.VolumeAsk }, func(t *tick.Tick, v float64) { t.VolumeAsk = v }},
+	{func(t *tick.Tick) float64 { return t.VolumeBid }, func(t *tick.Tick, v float64) { t.VolumeBid = v }},
+}
+
+// writePartition encodes ticks, which must share symbol and be ordered by timestamp, into w.
+func writePartition(w io.Writer, symbol string, ticks []*tick.Tick) error {
+	zw, err := compression.NewWriter(w, compression.Zstd, 0)
+	if err != nil {
+		return err
+	}
+
+	e := &encoder{w: bufio.NewWriter(zw)}
+	e.write(partitionMagic[:])
+	e.write([]byte{partitionVersion})
+	e.uvarint(uint64(len(symbol)))
+	e.write([]byte(symbol))
+	e.uvarint(uint64(len(ticks)))
+
+	var previous int64
+	for _, t := range ticks {
+		e.varint(t.Timestamp - previous)
+		previous = t.Timestamp
+	}
+
+	for _, column := range floatColumns {
+		values := make([]float64, len(ticks))
+		for i, t := range ticks {
+			values[i] = column.get(t)
+		}
+		e.floats(values)
+	}
+
+	if e.err != nil {
+		return e.err
+	}
+
+	if err := e.w.Flush(); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// readPartition decodes the ticks of a partition written by writePartition for symbol. A partition of
+// another symbol, e.g. a misplaced file, is an error.
+func readPartition(r io.Reader, symbol string) ([]*tick.Tick, error) {
+	zr := compression.NewReader(r)
+	defer zr.Close()
+
+	d := &decoder{r: bufio.NewReader(zr)}
+
+	var magic [4]byte
+	d.read(magic[:])
+	version := d.byte()
+	if d.err == nil && (magic != partitionMagic || version != partitionVersion) {
+		return nil, errors.New("not a tick partition")
+	}
+
+	symbolBytes := make([]byte, d.length())
+	d.read(symbolBytes)
+	count := d.length()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if string(symbolBytes) != symbol {
+		return nil, fmt.Errorf("partition holds symbol %s, want %s", symbolBytes, symbol)
+	}
+
+	ticks := make([]*tick.Tick, count)
+	var timestamp int64
+	for i := range ticks {
+		timestamp += d.varint()
+		ticks[i] = tick.New().WithSymbol(symbol).WithTimestamp(timestamp)
+	}
+
+	for _, column := range floatColumns {
+		for i, v := range d.floats(len(ticks)) {
+			column.set(ticks[i], v)
+		}
+	}
+
+	if d.err != nil {
+		return nil, fmt.Errorf("corrupt tick partition: %w", d.err)
+	}
+
+	return ticks, nil
+}
+
+// decimalScale returns the fewest decimal digits that represent every value exactly as a scaled integer.
+func decimalScale(values []float64) (int, bool) {
+	for digits := 0; digits <= maxDecimal; digits++ {
+		scale := math.Pow10(digits)
+		exact := true
+		for _, v := range values {
+			scaled := math.Round(v * scale)
+			if math.Abs(scaled) >= 1<<53 || scaled/scale != v {
+				exact = false
+				break
+			}
+		}
+
+		if exact {
+			return digits, true
+		}
+	}
+
+	return 0, false
+}
+
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) write(p []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(p)
+	}
+}
+
+func (e *encoder) uvarint(v uint64) {
+	e.write(binary.AppendUvarint(e.buf[:0], v))
+}
+
+func (e *encoder) varint(v int64) {
+	e.write(binary.AppendVarint(e.buf[:0], v))
+}
+
+func (e *encoder) floats(values []float64) {
+	digits, ok := decimalScale(values)
+	if !ok {
+		e.write([]byte{rawFloats})
+		var previous uint64
+		for _, v := range values {
+			bits := math.Float64bits(v)
+			e.uvarint(bits ^ previous)
+			previous = bits
+		}
+		return
+	}
+
+	e.write([]byte{byte(digits)})
+	scale := math.Pow10(digits)
+	var previous int64
+	for _, v := range values {
+		scaled := int64(math.Round(v * scale))
+		e.varint(scaled - previous)
+		previous = scaled
+	}
+}
+
+type decoder struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (d *decoder) read(p []byte) {
+	if d.err == nil {
+		_, d.err = io.ReadFull(d.r, p)
+	}
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	var b byte
+	b, d.err = d.r.ReadByte()
+	return b
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	var v uint64
+	v, d.err = binary.ReadUvarint(d.r)
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	var v int64
+	v, d.err = binary.ReadVarint(d.r)
+	return v
+}
+
+// length reads a count, bounded to keep corrupt input from allocating without limit.
+func (d *decoder) length() int {
+	n := d.uvarint()
+	if n > 1<<28 {
+		if d.err == nil {
+			d.err = fmt.Errorf("length %d out of range", n)
+		}
+		return 0
+	}
+
+	return int(n)
+}
+
+func (d *decoder) floats(n int) []float64 {
+	values := make([]float64, n)
+
+	digits := d.byte()
+	if digits == rawFloats {
+		var previous uint64
+		for i := range values {
+			previous ^= d.uvarint()
+			values[i] = math.Float64frombits(previous)
+		}
+		return values
+	}
+
+	if d.err == nil && digits > maxDecimal {
+		d.err = fmt.Errorf("invalid decimal scale %d", digits)
+	}
+
+	scale := math.Pow10(int(digits))
+	var scaled int64
+	for i := range values {
+		scaled += d.varint()
+		values[i] = float64(scaled) / scale
+	}
+
+	return values
+}
@@ -0,0 +1,120 @@
+package store
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/condrove10/dukascopy-downloader/tick"
+)
+
+func roundTrip(t *testing.T, symbol string, ticks []*tick.Tick) []*tick.Tick {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := writePartition(&buf, symbol, ticks); err != nil {
+		t.Fatalf("writePartition: %v", err)
+	}
+
+	got, err := readPartition(&buf, symbol)
+	if err != nil {
+		t.Fatalf("readPartition: %v", err)
+	}
+
+	return got
+}
+
+func assertTicks(t *testing.T, got []*tick.Tick, want []*tick.Tick) {
+	t.Helper()
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d ticks, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if *got[i] != *want[i] {
+			t.Fatalf("tick %d: got %+v, want %+v", i, *got[i], *want[i])
+		}
+	}
+}
+
+func TestPartitionRoundTrip(t *testing.T) {
+	const hour = int64(1704196800000000000)
+
+	tests := []struct {
+		name  string
+		ticks []*tick.Tick
+	}{
+		{
+			name: "decimal scaled",
+			ticks: []*tick.Tick{
+				{Symbol: "EURUSD", Timestamp: hour, Ask: 1.10234, Bid: 1.10231, VolumeAsk: 1.5, VolumeBid: 2.25},
+				{Symbol: "EURUSD", Timestamp: hour + 250_000_000, Ask: 1.10236, Bid: 1.1023, VolumeAsk: 0.75, VolumeBid: 3},
+				// Equal timestamps and a price falling back.
+				{Symbol: "EURUSD", Timestamp: hour + 250_000_000, Ask: 1.10229, Bid: 1.10227, VolumeAsk: 12, VolumeBid: 0.01},
+			},
+		},
+		{
+			name: "raw floats",
+			ticks: []*tick.Tick{
+				// Volumes decoded from the float32 datafeed values have no short decimal representation.
+				{Symbol: "USDJPY", Timestamp: hour, Ask: 151.234, Bid: 151.231, VolumeAsk: float64(float32(1.37)), VolumeBid: float64(float32(0.1))},
+				{Symbol: "USDJPY", Timestamp: hour + 1_000_000, Ask: 151.236, Bid: 151.233, VolumeAsk: float64(float32(2.63)), VolumeBid: float64(float32(4.2))},
+			},
+		},
+		{
+			name:  "empty",
+			ticks: []*tick.Tick{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			symbol := "EURUSD"
+			if len(tt.ticks) > 0 {
+				symbol = tt.ticks[0].Symbol
+			}
+
+			assertTicks(t, roundTrip(t, symbol, tt.ticks), tt.ticks)
+		})
+	}
+}
+
+func TestDecimalScale(t *testing.T) {
+	tests := []struct {
+		name   string
+		values []float64
+		digits int
+		ok     bool
+	}{
+		{name: "integers", values: []float64{1, 2, 300}, digits: 0, ok: true},
+		{name: "prices", values: []float64{1.10234, 1.1023, 1.1}, digits: 5, ok: true},
+		{name: "float32 volumes", values: []float64{float64(float32(1.37))}, ok: false},
+		{name: "empty", values: nil, digits: 0, ok: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			digits, ok := decimalScale(tt.values)
+			if ok != tt.ok || (ok && digits != tt.digits) {
+				t.Fatalf("got %d, %t, want %d, %t", digits, ok, tt.digits, tt.ok)
+			}
+		})
+	}
+}
+
+func TestReadPartitionRejectsOtherData(t *testing.T) {
+	if _, err := readPartition(bytes.NewReader([]byte("symbol,timestamp\n")), "EURUSD"); err == nil {
+		t.Fatal("readPartition accepted data that is not a partition")
+	}
+}
+
+func TestReadPartitionRejectsOtherSymbol(t *testing.T) {
+	var buf bytes.Buffer
+	ticks := []*tick.Tick{{Symbol: "GBPUSD", Timestamp: 1, Ask: 1.25, Bid: 1.24}}
+	if err := writePartition(&buf, "GBPUSD", ticks); err != nil {
+		t.Fatalf("writePartition: %v", err)
+	}
+
+	if _, err := readPartition(&buf, "EURUSD"); err == nil {
+		t.Fatal("readPartition served a GBPUSD partition as EURUSD")
+	}
+}
@@ -0,0 +1,364 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	downloader "github.com/condrove10/dukascopy-downloader"
+	"github.com/condrove10/dukascopy-downloader/cursor"
+	"github.com/condrove10/dukascopy-downloader/internal/timeformat"
+	"github.com/condrove10/dukascopy-downloader/tick"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	partitionExt  = ".ticks"
+	partitionPath = "2006/01/02"
+)
+
+// Store is a local tick dataset kept under a root directory, one partition file per symbol and UTC day:
+// <root>/<symbol>/<yyyy>/<mm>/<dd>.ticks. A partition is only written once its day is complete, so the
+// partitions present are the coverage of the store. A Store is safe for concurrent use; partitions are
+// written atomically.
+type Store struct {
+	root       string
+	downloader *downloader.Downloader
+	clock      downloader.Clock
+	bufferSize int
+}
+
+// Open returns the store rooted at root, creating the directory if needed. Without a downloader set
+// through WithDownloader, queries only read the partitions already stored.
+func Open(root string) (*Store, error) {
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create store %s: %w", root, err)
+	}
+
+	return &Store{root: root, bufferSize: 1}, nil
+}
+
+// WithDownloader sets the downloader missing partitions are fetched with. The store keeps a copy of d,
+// whose Symbol, StartTime and EndTime are replaced for every partition; every other setting is kept,
+// and every partition shares its bandwidth limit.
+func (s *Store) WithDownloader(d *downloader.Downloader) *Store {
+	if d == nil {
+		s.downloader = nil
+		return s
+	}
+
+	dl := *d
+	if dl.BandwidthLimiter == nil && dl.BandwidthLimit > 0 {
+		dl.WithBandwidthLimit(dl.BandwidthLimit)
+	}
+
+	s.downloader = &dl
+	return s
+}
+
+// WithClock sets the clock deciding which days are complete; nil uses the downloader clock or the system clock.
+func (s *Store) WithClock(clock downloader.Clock) *Store {
+	s.clock = clock
+	return s
+}
+
+// WithBufferSize sets the number of ticks a query cursor buffers ahead of its consumer.
+func (s *Store) WithBufferSize(bufferSize int) *Store {
+	s.bufferSize = bufferSize
+	return s
+}
+
+// Range is a half-open UTC time range [Start, End).
+type Range struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Coverage returns the ranges of whole days stored for symbol, merged and in order.
+func (s *Store) Coverage(symbol string) ([]Range, error) {
+	days, err := s.days(symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []Range
+	for _, d := range days {
+		if n := len(ranges); n > 0 && ranges[n-1].End.Equal(d) {
+			ranges[n-1].End = timeformat.Day.Next(d)
+			continue
+		}
+		ranges = append(ranges, Range{Start: d, End: timeformat.Day.Next(d)})
+	}
+
+	return ranges, nil
+}
+
+// Missing returns the complete days overlapping [start, end) that are not stored for symbol.
+func (s *Store) Missing(symbol string, start time.Time, end time.Time) ([]time.Time, error) {
+	if err := validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	var missing []time.Time
+	for _, d := range s.span(start, end) {
+		if !s.complete(d) {
+			continue
+		}
+
+		if _, err := os.Stat(s.path(symbol, d)); errors.Is(err, fs.ErrNotExist) {
+			missing = append(missing, d)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return missing, nil
+}
+
+// Fill downloads and stores the missing complete days overlapping [start, end) for every symbol.
+func (s *Store) Fill(ctx context.Context, symbols []string, start time.Time, end time.Time) error {
+	for _, symbol := range symbols {
+		missing, err := s.Missing(symbol, start, end)
+		if err != nil {
+			return err
+		}
+
+		for _, d := range missing {
+			if _, err := s.fetch(ctx, symbol, d); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Query returns a cursor over the ticks of symbols in [start, end), ordered by timestamp and, for equal
+// timestamps, by the order of symbols. Stored partitions are read from disk; missing complete days are
+// downloaded and stored on demand, and the ticks of the current day are downloaded without being stored.
+// Without a downloader, missing days fail the query.
+func (s *Store) Query(ctx context.Context, symbols []string, start time.Time, end time.Time) (*cursor.Cursor, error) {
+	if !start.Before(end) {
+		return nil, fmt.Errorf("start time %s must be before end time %s", start, end)
+	}
+
+	for _, symbol := range symbols {
+		if err := validateSymbol(symbol); err != nil {
+			return nil, err
+		}
+	}
+
+	// Closing the cursor cancels the downloads in flight instead of waiting for them.
+	return cursor.FromSeqContext(ctx, func(ctx context.Context) iter.Seq2[*tick.Tick, error] {
+		sources := make([]iter.Seq2[*tick.Tick, error], len(symbols))
+		for i, symbol := range symbols {
+			sources[i] = s.ticks(ctx, symbol, start, end)
+		}
+
+		return merge(sources)
+	}, s.bufferSize), nil
+}
+
+// ticks yields the ticks of one symbol in [start, end), day by day.
+func (s *Store) ticks(ctx context.Context, symbol string, start time.Time, end time.Time) iter.Seq2[*tick.Tick, error] {
+	return func(yield func(*tick.Tick, error) bool) {
+		for _, d := range s.span(start, end) {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			ticks, err := s.partition(ctx, symbol, d)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			for _, t := range ticks {
+				if t.Timestamp < start.UnixNano() || t.Timestamp >= end.UnixNano() {
+					continue
+				}
+
+				if !yield(t, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// partition returns the ticks of symbol on day d, reading, fetching and storing, or downloading them live.
+func (s *Store) partition(ctx context.Context, symbol string, d time.Time) ([]*tick.Tick, error) {
+	f, err := os.Open(s.path(symbol, d))
+	if err == nil {
+		defer f.Close()
+
+		ticks, err := readPartition(f, symbol)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read partition %s: %w", f.Name(), err)
+		}
+		return ticks, nil
+	}
+
+	if !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open partition: %w", err)
+	}
+
+	return s.fetch(ctx, symbol, d)
+}
+
+// fetch downloads the ticks of symbol on day d and stores them if the day is complete.
+func (s *Store) fetch(ctx context.Context, symbol string, d time.Time) ([]*tick.Tick, error) {
+	if s.downloader == nil {
+		return nil, fmt.Errorf("partition %s %s is not stored and the store has no downloader", symbol, d.Format(time.DateOnly))
+	}
+
+	complete := s.complete(d)
+	end := timeformat.Day.Next(d)
+	if !complete {
+		// Only the hours that already ended are available.
+		end = s.now().Truncate(time.Hour)
+		if !end.After(d) {
+			return nil, nil
+		}
+	}
+
+	dl := *s.downloader
+	dl.Symbol = symbol
+	dl.StartTime = d
+	dl.EndTime = end
+
+	var ticks []*tick.Tick
+	for t, err := range dl.Ticks(ctx) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to download %s %s: %w", symbol, d.Format(time.DateOnly), err)
+		}
+		ticks = append(ticks, t)
+	}
+
+	if complete {
+		if err := s.store(symbol, d, ticks); err != nil {
+			return nil, err
+		}
+	}
+
+	return ticks, nil
+}
+
+// store writes a partition to a temporary file and renames it into place.
+func (s *Store) store(symbol string, d time.Time, ticks []*tick.Tick) error {
+	path := s.path(symbol, d)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create partition directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create partition: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	err = writePartition(tmp, symbol, ticks)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write partition %s: %w", path, err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write partition %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// days returns the days stored for symbol, in order.
+func (s *Store) days(symbol string) ([]time.Time, error) {
+	if err := validateSymbol(symbol); err != nil {
+		return nil, err
+	}
+
+	var days []time.Time
+	root := filepath.Join(s.root, symbol)
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == root {
+				return filepath.SkipDir
+			}
+			return err
+		}
+
+		if entry.IsDir() || !strings.HasSuffix(path, partitionExt) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, strings.TrimSuffix(path, partitionExt))
+		if err != nil {
+			return err
+		}
+
+		d, err := time.Parse(partitionPath, filepath.ToSlash(rel))
+		if err != nil {
+			// Not a partition, e.g. a temporary file left behind.
+			return nil
+		}
+		days = append(days, d)
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partitions of %s: %w", symbol, err)
+	}
+
+	slices.SortFunc(days, func(a, b time.Time) int { return a.Compare(b) })
+
+	return days, nil
+}
+
+func (s *Store) path(symbol string, d time.Time) string {
+	return filepath.Join(s.root, symbol, filepath.FromSlash(d.Format(partitionPath))+partitionExt)
+}
+
+// span returns the UTC start of every day overlapping [start, end).
+func (s *Store) span(start time.Time, end time.Time) []time.Time {
+	var days []time.Time
+	for d := timeformat.Day.Truncate(start); d.Before(end); d = timeformat.Day.Next(d) {
+		days = append(days, d)
+	}
+
+	return days
+}
+
+// complete reports whether day d has ended.
+func (s *Store) complete(d time.Time) bool {
+	return !timeformat.Day.Next(d).After(s.now())
+}
+
+func (s *Store) now() time.Time {
+	switch {
+	case s.clock != nil:
+		return s.clock.Now()
+	case s.downloader != nil && s.downloader.Clock != nil:
+		return s.downloader.Clock.Now()
+	default:
+		return time.Now()
+	}
+}
+
+// validateSymbol rejects symbols that cannot safely name a partition directory.
+func validateSymbol(symbol string) error {
+	if symbol == "" || symbol == "." || symbol == ".." || strings.ContainsAny(symbol, `/\`) {
+		return fmt.Errorf("invalid symbol %q", symbol)
+	}
+
+	return nil
+}
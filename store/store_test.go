@@ -0,0 +1,97 @@
+package store
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	downloader "github.com/condrove10/dukascopy-downloader"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+// blockingTransport answers no request until its context is done.
+type blockingTransport struct {
+	started chan struct{}
+}
+
+func (b *blockingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	select {
+	case b.started <- struct{}{}:
+	default:
+	}
+
+	<-r.Context().Done()
+	return nil, r.Context().Err()
+}
+
+func TestQueryCloseCancelsDownloads(t *testing.T) {
+	transport := &blockingTransport{started: make(chan struct{}, 1)}
+	d := &downloader.Downloader{
+		Concurrency: 1,
+		HttpClient:  &http.Client{Transport: transport},
+	}
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.WithDownloader(d).WithClock(fixedClock(time.Date(2024, 1, 10, 0, 0, 0, 0, time.UTC)))
+
+	c, err := s.Query(context.Background(), []string{"EURUSD"}, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("Query: %v", err)
+	}
+
+	next := make(chan bool)
+	go func() {
+		next <- c.Next(context.Background())
+	}()
+
+	select {
+	case <-transport.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the query did not start downloading")
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		c.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close waited for the download in flight")
+	}
+
+	if <-next {
+		t.Fatal("Next returned a tick from a cancelled download")
+	}
+}
+
+func TestWithDownloaderKeepsCallerDownloader(t *testing.T) {
+	d := &downloader.Downloader{Concurrency: 1, BandwidthLimit: 1 << 20}
+
+	s, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	s.WithDownloader(d)
+
+	if d.BandwidthLimiter != nil {
+		t.Fatal("WithDownloader changed the caller's downloader")
+	}
+	if s.downloader == d {
+		t.Fatal("the store shares the caller's downloader")
+	}
+	if s.downloader.BandwidthLimiter == nil {
+		t.Fatal("the store downloader has no shared limiter")
+	}
+}
@@ -0,0 +1,142 @@
+package stream
+
+import (
+	"iter"
+)
+
+// Filter yields only the values for which keep returns true.
+// Errors from seq are always passed through.
+func Filter[T any](seq iter.Seq2[T, error], keep func(T) bool) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for v, err := range seq {
+			if err != nil {
+				if !yield(v, err) {
+					return
+				}
+				continue
+			}
+
+			if keep(v) && !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Map yields fn applied to every value of seq.
+// Errors from seq are passed through with the zero value of U.
+func Map[T, U any](seq iter.Seq2[T, error], fn func(T) U) iter.Seq2[U, error] {
+	return func(yield func(U, error) bool) {
+		for v, err := range seq {
+			if err != nil {
+				var zero U
+				if !yield(zero, err) {
+					return
+				}
+				continue
+			}
+
+			if !yield(fn(v), nil) {
+				return
+			}
+		}
+	}
+}
+
+// TakeWhile yields values until keep returns false for the first time.
+func TakeWhile[T any](seq iter.Seq2[T, error], keep func(T) bool) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for v, err := range seq {
+			if err != nil {
+				if !yield(v, err) {
+					return
+				}
+				continue
+			}
+
+			if !keep(v) || !yield(v, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Window yields sliding windows of size values, advancing by step values between windows.
+// Only full windows are yielded; each window is a fresh slice the caller may retain.
+func Window[T any](seq iter.Seq2[T, error], size, step int) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		if size <= 0 || step <= 0 {
+			return
+		}
+
+		buf := make([]T, 0, size)
+		skip := 0
+		for v, err := range seq {
+			if err != nil {
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+
+			if skip > 0 {
+				skip--
+				continue
+			}
+
+			buf = append(buf, v)
+			if len(buf) < size {
+				continue
+			}
+
+			window := make([]T, size)
+			copy(window, buf)
+			if !yield(window, nil) {
+				return
+			}
+
+			if step < size {
+				buf = append(buf[:0], buf[step:]...)
+			} else {
+				buf = buf[:0]
+				skip = step - size
+			}
+		}
+	}
+}
+
+// Batch yields consecutive chunks of up to size values; the last chunk may be shorter.
+func Batch[T any](seq iter.Seq2[T, error], size int) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		if size <= 0 {
+			return
+		}
+
+		batch := make([]T, 0, size)
+		for v, err := range seq {
+			if err != nil {
+				if len(batch) > 0 && !yield(batch, nil) {
+					return
+				}
+				batch = make([]T, 0, size)
+
+				if !yield(nil, err) {
+					return
+				}
+				continue
+			}
+
+			batch = append(batch, v)
+			if len(batch) == size {
+				if !yield(batch, nil) {
+					return
+				}
+				batch = make([]T, 0, size)
+			}
+		}
+
+		if len(batch) > 0 {
+			yield(batch, nil)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package timestamp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kind selects how a Format renders timestamps.
+type Kind string
+
+const (
+	UnixSeconds Kind = "unix_s"
+	UnixMillis  Kind = "unix_ms"
+	UnixMicros  Kind = "unix_us"
+	UnixNanos   Kind = "unix_ns"
+	// RFC3339 renders an RFC3339 date and time with Precision fractional second digits.
+	RFC3339 Kind = "rfc3339"
+	// Layout renders with the custom Go layout in Layout.
+	Layout Kind = "layout"
+	// Split renders separate date and time columns, the time with Precision fractional second digits.
+	Split Kind = "split"
+)
+
+// Format describes how an exporter renders timestamps. The zero Format renders Unix nanoseconds.
+type Format struct {
+	Kind Kind
+	// Precision is the number of fractional second digits, 0 to 9, for RFC3339 and Split;
+	// a negative precision prints as many digits as needed.
+	Precision int
+	// Layout is the Go time layout used by Kind Layout.
+	Layout string
+	// Location is the timezone dates are rendered in; nil means UTC.
+	Location *time.Location
+}
+
+// DefaultFormat returns the format exporters use when none is configured: Unix nanoseconds when loc is nil,
+// otherwise RFC3339 with nanosecond precision in loc.
+func DefaultFormat(loc *time.Location) Format {
+	if loc == nil {
+		return Format{Kind: UnixNanos}
+	}
+
+	return Format{Kind: RFC3339, Precision: -1, Location: loc}
+}
+
+// ParseFormat parses a format specification as accepted on the command line:
+// unix_s, unix_ms, unix_us, unix_ns, rfc3339[:digits], split[:digits] or layout:<go layout>.
+func ParseFormat(spec string) (Format, error) {
+	kind, arg, hasArg := strings.Cut(spec, ":")
+
+	switch Kind(kind) {
+	case UnixSeconds, UnixMillis, UnixMicros, UnixNanos:
+		if hasArg {
+			return Format{}, fmt.Errorf("timestamp format %q takes no argument", kind)
+		}
+
+		return Format{Kind: Kind(kind)}, nil
+	case RFC3339, Split:
+		precision := -1
+		if hasArg {
+			p, err := strconv.Atoi(arg)
+			if err != nil || p < 0 || p > 9 {
+				return Format{}, fmt.Errorf("invalid timestamp precision %q, want 0 to 9", arg)
+			}
+			precision = p
+		}
+
+		return Format{Kind: Kind(kind), Precision: precision}, nil
+	case Layout:
+		if arg == "" {
+			return Format{}, fmt.Errorf("timestamp format layout requires a Go layout, e.g. layout:2006-01-02 15:04:05")
+		}
+
+		return Format{Kind: Layout, Layout: arg}, nil
+	default:
+		return Format{}, fmt.Errorf("unknown timestamp format %q", spec)
+	}
+}
+
+// WithLocation returns a copy of the format rendering dates in loc.
+func (f Format) WithLocation(loc *time.Location) Format {
+	f.Location = loc
+	return f
+}
+
+// Columns returns the names of the columns a timestamp field called name is rendered into.
+func (f Format) Columns(name string) []string {
+	if f.Kind == Split {
+		return []string{"date", "time"}
+	}
+
+	return []string{name}
+}
+
+// Unix returns the timestamp as an integer in the unit of a Unix kind, reporting false for other kinds.
+func (f Format) Unix(nanos int64) (int64, bool) {
+	switch f.Kind {
+	case "", UnixNanos:
+		return nanos, true
+	case UnixMicros:
+		return floorDiv(nanos, int64(time.Microsecond)), true
+	case UnixMillis:
+		return floorDiv(nanos, int64(time.Millisecond)), true
+	case UnixSeconds:
+		return floorDiv(nanos, int64(time.Second)), true
+	default:
+		return 0, false
+	}
+}
+
+// Values renders the timestamp into one value per column: integers for the Unix kinds, strings otherwise.
+func (f Format) Values(nanos int64) []interface{} {
+	if unix, ok := f.Unix(nanos); ok {
+		return []interface{}{unix}
+	}
+
+	t := time.Unix(0, nanos).In(f.location())
+	switch f.Kind {
+	case Split:
+		return []interface{}{t.Format(time.DateOnly), t.Format("15:04:05" + fraction(f.Precision))}
+	case Layout:
+		return []interface{}{t.Format(f.Layout)}
+	default:
+		return []interface{}{t.Format("2006-01-02T15:04:05" + fraction(f.Precision) + "Z07:00")}
+	}
+}
+
+// Parse is the inverse of Values: it reads the Unix nanoseconds of a timestamp from one value per column.
+// Wall times without offset are read in the location of the format, resolved like ResolveWallTime.
+func (f Format) Parse(values []string) (int64, error) {
+	if len(values) != len(f.Columns("")) {
+		return 0, fmt.Errorf("timestamp format %q expects %d values, got %d", f.Kind, len(f.Columns("")), len(values))
+	}
+
+	var unit time.Duration
+	switch f.Kind {
+	case "", UnixNanos:
+		unit = time.Nanosecond
+	case UnixMicros:
+		unit = time.Microsecond
+	case UnixMillis:
+		unit = time.Millisecond
+	case UnixSeconds:
+		unit = time.Second
+	}
+
+	if unit != 0 {
+		v, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid Unix timestamp %q: %w", values[0], err)
+		}
+
+		return v * int64(unit), nil
+	}
+
+	switch f.Kind {
+	case Split:
+		wall, err := time.Parse(time.DateTime, values[0]+" "+values[1])
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q %q: %w", values[0], values[1], err)
+		}
+
+		return ResolveWallTime(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), f.location()).UnixNano(), nil
+	case Layout:
+		t, err := time.ParseInLocation(f.Layout, values[0], f.location())
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q: %w", values[0], err)
+		}
+
+		return t.UnixNano(), nil
+	default:
+		t, err := time.Parse(time.RFC3339Nano, values[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid timestamp %q: %w", values[0], err)
+		}
+
+		return t.UnixNano(), nil
+	}
+}
+
+// Round returns the timestamp an export in the format reads back for nanos, dropping what the format
+// does not render, e.g. sub-millisecond digits for UnixMillis.
+func (f Format) Round(nanos int64) (int64, error) {
+	values := f.Values(nanos)
+	rendered := make([]string, len(values))
+	for i, v := range values {
+		rendered[i] = fmt.Sprint(v)
+	}
+
+	return f.Parse(rendered)
+}
+
+// Render is Values for formats with a single column.
+func (f Format) Render(nanos int64) interface{} {
+	return f.Values(nanos)[0]
+}
+
+func (f Format) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+
+	return f.Location
+}
+
+func fraction(precision int) string {
+	switch {
+	case precision < 0:
+		return ".999999999"
+	case precision == 0:
+		return ""
+	default:
+		return "." + strings.Repeat("0", min(precision, 9))
+	}
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+
+	return q
+}
@@ -0,0 +1,73 @@
+package timestamp
+
+import (
+	"time"
+)
+
+// ResolveWallTime returns the instant at which a wall clock in loc shows the given date and time.
+// A wall time skipped by a DST gap resolves to the end of the gap; a wall time repeated by a DST
+// overlap resolves to its first occurrence.
+func ResolveWallTime(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) time.Time {
+	candidates := WallTimeCandidates(year, month, day, hour, min, sec, nsec, loc)
+	if len(candidates) > 0 {
+		return candidates[0]
+	}
+
+	return gapEnd(time.Date(year, month, day, hour, min, sec, nsec, time.UTC), loc)
+}
+
+// WallTimeCandidates returns, in ascending order, every instant at which a wall clock in loc shows
+// the given date and time: none inside a DST gap, two inside a DST overlap and one otherwise.
+func WallTimeCandidates(year int, month time.Month, day, hour, min, sec, nsec int, loc *time.Location) []time.Time {
+	wall := time.Date(year, month, day, hour, min, sec, nsec, time.UTC)
+
+	var candidates []time.Time
+	for _, probe := range []time.Time{wall.Add(-48 * time.Hour), wall.Add(48 * time.Hour)} {
+		_, offset := probe.In(loc).Zone()
+		candidate := wall.Add(-time.Duration(offset) * time.Second)
+		if !sameWallTime(candidate.In(loc), wall) {
+			continue
+		}
+
+		if len(candidates) == 0 || !candidates[0].Equal(candidate) {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	if len(candidates) == 2 && candidates[1].Before(candidates[0]) {
+		candidates[0], candidates[1] = candidates[1], candidates[0]
+	}
+
+	return candidates
+}
+
+func sameWallTime(t time.Time, wall time.Time) bool {
+	y1, m1, d1 := t.Date()
+	y2, m2, d2 := wall.Date()
+	return y1 == y2 && m1 == m2 && d1 == d2 && t.Hour() == wall.Hour() && t.Minute() == wall.Minute() &&
+		t.Second() == wall.Second() && t.Nanosecond() == wall.Nanosecond()
+}
+
+// gapEnd returns the first instant after the DST gap containing the wall time.
+func gapEnd(wall time.Time, loc *time.Location) time.Time {
+	_, before := wall.Add(-48 * time.Hour).In(loc).Zone()
+	_, after := wall.Add(48 * time.Hour).In(loc).Zone()
+
+	// The transition lies between the wall time read with the offset after the gap and with the offset before it.
+	lo := wall.Add(-time.Duration(after) * time.Second)
+	hi := wall.Add(-time.Duration(before) * time.Second)
+	if hi.Before(lo) {
+		lo, hi = hi, lo
+	}
+
+	for hi.Sub(lo) > time.Second {
+		mid := lo.Add(hi.Sub(lo) / 2)
+		if _, offset := mid.In(loc).Zone(); offset == before {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return hi.Truncate(time.Second)
+}
@@ -0,0 +1,85 @@
+package timestamp
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func mustLoad(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("LoadLocation(%s): %v", name, err)
+	}
+
+	return loc
+}
+
+func utc(value string) time.Time {
+	t, err := time.Parse(time.DateTime, value)
+	if err != nil {
+		panic(err)
+	}
+
+	return t
+}
+
+// dstCases cover both 2024 transitions in New York and London, at the edges and inside the gaps and overlaps.
+var dstCases = []struct {
+	name     string
+	location string
+	wall     string
+	// resolved is the UTC instant ResolveWallTime returns; candidates are every UTC instant showing the wall time.
+	resolved   string
+	candidates []string
+}{
+	{"new york before spring gap", "America/New_York", "2024-03-10 01:30:00", "2024-03-10 06:30:00", []string{"2024-03-10 06:30:00"}},
+	{"new york spring gap", "America/New_York", "2024-03-10 02:30:00", "2024-03-10 07:00:00", nil},
+	{"new york spring gap start", "America/New_York", "2024-03-10 02:00:00", "2024-03-10 07:00:00", nil},
+	{"new york after spring gap", "America/New_York", "2024-03-10 03:00:00", "2024-03-10 07:00:00", []string{"2024-03-10 07:00:00"}},
+	{"new york before fall overlap", "America/New_York", "2024-11-03 00:30:00", "2024-11-03 04:30:00", []string{"2024-11-03 04:30:00"}},
+	{"new york fall overlap", "America/New_York", "2024-11-03 01:30:00", "2024-11-03 05:30:00", []string{"2024-11-03 05:30:00", "2024-11-03 06:30:00"}},
+	{"new york fall overlap start", "America/New_York", "2024-11-03 01:00:00", "2024-11-03 05:00:00", []string{"2024-11-03 05:00:00", "2024-11-03 06:00:00"}},
+	{"new york after fall overlap", "America/New_York", "2024-11-03 02:00:00", "2024-11-03 07:00:00", []string{"2024-11-03 07:00:00"}},
+	{"london before spring gap", "Europe/London", "2024-03-31 00:30:00", "2024-03-31 00:30:00", []string{"2024-03-31 00:30:00"}},
+	{"london spring gap", "Europe/London", "2024-03-31 01:30:00", "2024-03-31 01:00:00", nil},
+	{"london after spring gap", "Europe/London", "2024-03-31 02:30:00", "2024-03-31 01:30:00", []string{"2024-03-31 01:30:00"}},
+	{"london before fall overlap", "Europe/London", "2024-10-27 00:30:00", "2024-10-26 23:30:00", []string{"2024-10-26 23:30:00"}},
+	{"london fall overlap", "Europe/London", "2024-10-27 01:30:00", "2024-10-27 00:30:00", []string{"2024-10-27 00:30:00", "2024-10-27 01:30:00"}},
+	{"london after fall overlap", "Europe/London", "2024-10-27 02:00:00", "2024-10-27 02:00:00", []string{"2024-10-27 02:00:00"}},
+}
+
+func TestResolveWallTime(t *testing.T) {
+	for _, tt := range dstCases {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := mustLoad(t, tt.location)
+			w := utc(tt.wall)
+
+			got := ResolveWallTime(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), loc)
+			if want := utc(tt.resolved); !got.Equal(want) {
+				t.Fatalf("got %s, want %s", got.UTC(), want)
+			}
+		})
+	}
+}
+
+func TestWallTimeCandidates(t *testing.T) {
+	for _, tt := range dstCases {
+		t.Run(tt.name, func(t *testing.T) {
+			loc := mustLoad(t, tt.location)
+			w := utc(tt.wall)
+
+			got := WallTimeCandidates(w.Year(), w.Month(), w.Day(), w.Hour(), w.Minute(), w.Second(), w.Nanosecond(), loc)
+			if len(got) != len(tt.candidates) {
+				t.Fatalf("got %v, want %v", got, tt.candidates)
+			}
+			for i, c := range tt.candidates {
+				if want := utc(c); !got[i].Equal(want) {
+					t.Fatalf("candidate %d: got %s, want %s", i, got[i].UTC(), want)
+				}
+			}
+		})
+	}
+}